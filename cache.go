@@ -0,0 +1,212 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/Masterminds/vcs"
+)
+
+var regexScheme = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9+.\-]*://`)
+
+// mirrorLockStale is the age after which the lock of a mirror is assumed to be left behind by an aborted process
+const mirrorLockStale = 30 * time.Minute
+
+// resolveCacheDir returns the directory shared by all projects to store repository mirrors in
+func resolveCacheDir() string {
+	if p := os.Getenv("VGO_CACHE"); len(p) > 0 {
+		return p
+	}
+	return filepath.Join(os.Getenv("HOME"), ".cache", "vgo")
+}
+
+// Mirror is a bare copy of a remote repository in the shared cache. Dependencies are cloned from their mirror so
+// repositories used by multiple projects are only downloaded once, and references already in the mirror are installed
+// without any network access.
+type Mirror struct {
+	URL  string
+	Type vcs.Type
+	Path string
+}
+
+// NewMirror resolves the mirror of the repository at the url. Mirrors are only supported for git and hg, nil is returned
+// for other repository types.
+func NewMirror(repoType vcs.Type, url string) *Mirror {
+	switch repoType {
+	case vcs.Git, vcs.Hg:
+	default:
+		return nil
+	}
+	return &Mirror{
+		URL:  url,
+		Type: repoType,
+		Path: filepath.Join(resolveCacheDir(), string(repoType), cacheKey(url)),
+	}
+}
+
+// cacheKey converts the url into a relative path e.g. git@github.com:foo/bar.git becomes github.com/foo/bar
+func cacheKey(url string) string {
+	key := regexScheme.ReplaceAllString(url, "")
+	if i := strings.Index(key, "@"); i >= 0 && i < strings.IndexAny(key+"/", ":/") {
+		key = key[i+1:]
+	}
+	key = strings.Replace(key, ":", "/", -1)
+	key = strings.TrimSuffix(strings.Trim(key, "/"), ".git")
+	parts := []string{}
+	for _, p := range strings.Split(key, "/") {
+		if len(p) > 0 && p != "." && p != ".." {
+			parts = append(parts, p)
+		}
+	}
+	return filepath.Join(parts...)
+}
+
+// mirrorURL resolves the original url of a repository cloned from a mirror, other urls are returned as is
+func mirrorURL(remote string) string {
+	dir := resolveCacheDir()
+	if !strings.HasPrefix(remote, dir+string(filepath.Separator)) {
+		return remote
+	}
+	var out []byte
+	var err error
+	if _, e := os.Stat(filepath.Join(remote, ".hg")); e == nil {
+		out, err = exec.Command("hg", "paths", "default", "-R", remote).Output()
+	} else {
+		out, err = exec.Command("git", "--git-dir", remote, "config", "--get", "remote.origin.url").Output()
+	}
+	if err != nil {
+		return remote
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// Exists checks whether the mirror was created before
+func (m *Mirror) Exists() bool {
+	marker := "HEAD"
+	if m.Type == vcs.Hg {
+		marker = ".hg"
+	}
+	_, err := os.Stat(filepath.Join(m.Path, marker))
+	return err == nil
+}
+
+// lock prevents other processes from cloning or fetching the mirror at the same time. The returned func releases the
+// lock.
+func (m *Mirror) lock() (func(), error) {
+	err := os.MkdirAll(filepath.Dir(m.Path), os.FileMode(0755))
+	if err != nil {
+		return nil, err
+	}
+	path := m.Path + ".lock"
+	for {
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, os.FileMode(0644))
+		if err == nil {
+			f.Close()
+			return func() { os.Remove(path) }, nil
+		}
+		if !os.IsExist(err) {
+			return nil, fmt.Errorf("Unable to lock the mirror of %s with error %s", m.URL, err.Error())
+		}
+		if info, err := os.Stat(path); err == nil && time.Since(info.ModTime()) > mirrorLockStale {
+			os.Remove(path)
+			continue
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+// Get creates the mirror when it doesn't exist yet
+func (m *Mirror) Get() error {
+	if m.Exists() {
+		return nil
+	}
+	if offline {
+		return fmt.Errorf("Unable to clone %s in offline mode, it is not cached", m.URL)
+	}
+	unlock, err := m.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	// Another process may have created the mirror while waiting for the lock
+	if m.Exists() {
+		return nil
+	}
+	switch m.Type {
+	case vcs.Git:
+		return m.run("", "git", "clone", "--mirror", m.URL, m.Path)
+	case vcs.Hg:
+		return m.run("", "hg", "clone", "-U", m.URL, m.Path)
+	}
+	return nil
+}
+
+// Update fetches the new references of the remote repository into the mirror. The url of the mirror is used rather
+// than the one it was cloned from, as urls with another scheme or user share the mirror.
+func (m *Mirror) Update() error {
+	if !m.Exists() {
+		return m.Get()
+	}
+	if offline {
+		return fmt.Errorf("Unable to fetch %s in offline mode", m.URL)
+	}
+	unlock, err := m.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	switch m.Type {
+	case vcs.Git:
+		err = m.setRemote()
+		if err != nil {
+			return err
+		}
+		return m.run(m.Path, "git", "fetch", "--prune", "origin")
+	case vcs.Hg:
+		return m.run(m.Path, "hg", "pull", m.URL)
+	}
+	return nil
+}
+
+// setRemote points the origin of a git mirror to the url of the mirror
+func (m *Mirror) setRemote() error {
+	out, err := exec.Command("git", "--git-dir", m.Path, "config", "--get", "remote.origin.url").Output()
+	if err == nil && strings.TrimSpace(string(out)) == m.URL {
+		return nil
+	}
+	return m.run(m.Path, "git", "remote", "set-url", "origin", m.URL)
+}
+
+// HasReference checks whether the reference is available in the mirror
+func (m *Mirror) HasReference(ref string) bool {
+	if !m.Exists() {
+		return false
+	}
+	switch m.Type {
+	case vcs.Git:
+		return m.run(m.Path, "git", "rev-parse", "--verify", "--quiet", ref+"^{commit}") == nil
+	case vcs.Hg:
+		return m.run(m.Path, "hg", "log", "-r", ref) == nil
+	}
+	return false
+}
+
+func (m *Mirror) run(dir string, name string, args ...string) error {
+	_, err := m.output(dir, name, args...)
+	return err
+}
+
+func (m *Mirror) output(dir string, name string, args ...string) ([]byte, error) {
+	cmd := exec.Command(name, args...)
+	cmd.Dir = dir
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return nil, fmt.Errorf("Unable to mirror %s with error %s: %s", m.URL, err.Error(), strings.TrimSpace(string(out)))
+	}
+	return out, nil
+}
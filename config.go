@@ -0,0 +1,80 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// config contains the global settings shared by all projects
+var config = Config{}
+
+func resolveConfigFilePath() string {
+	if p := os.Getenv("VGO_CONFIG"); len(p) > 0 {
+		return p
+	}
+	return filepath.Join(os.Getenv("HOME"), ".config", "vgo", "config.yaml")
+}
+
+// Config describes the global vgo settings stored in $VGO_CONFIG (~/.config/vgo/config.yaml by default)
+type Config struct {
+	Rewrite []RewriteRule `yaml:"rewrite,omitempty"`
+}
+
+// LoadConfig reads the global settings
+func LoadConfig() error {
+	data, err := ioutil.ReadFile(resolveConfigFilePath())
+	if err != nil {
+		return err
+	}
+	return yaml.Unmarshal(data, &config)
+}
+
+// RewriteRule replaces the url of matching repositories, similar to git's insteadOf. A match containing a "*"
+// wildcard is matched against the import path of the repo and the wildcard is substituted into the url e.g.
+// "github.com/*" to "https://github.com/*.git". A match without a wildcard replaces either the import path of the
+// repo e.g. "github.com/ourorg/tool" to "https://mirror.example.com/tool.git" or the url prefix e.g.
+// "git@github.com:" to "https://github.com/". Rules without a match or url are ignored.
+type RewriteRule struct {
+	Match string `yaml:"match"`
+	URL   string `yaml:"url"`
+}
+
+// Apply the rule to the repo with the given import path and url
+func (rule RewriteRule) Apply(name, url string) (string, bool) {
+	if len(rule.Match) == 0 || len(rule.URL) == 0 {
+		return url, false
+	}
+	i := strings.Index(rule.Match, "*")
+	if i < 0 {
+		switch {
+		case name == rule.Match:
+			return rule.URL, true
+		case strings.HasPrefix(url, rule.URL):
+			// Already rewritten e.g. the remote of an existing checkout
+			return url, true
+		case strings.HasPrefix(url, rule.Match):
+			return rule.URL + strings.TrimPrefix(url, rule.Match), true
+		}
+		return url, false
+	}
+	prefix, suffix := rule.Match[:i], rule.Match[i+1:]
+	if !strings.HasPrefix(name, prefix) || !strings.HasSuffix(name, suffix) || len(name) < len(prefix)+len(suffix) {
+		return url, false
+	}
+	wildcard := name[len(prefix) : len(name)-len(suffix)]
+	return strings.Replace(rule.URL, "*", wildcard, -1), true
+}
+
+// rewriteURL applies the first matching rewrite rule to the url, project rules take precedence over global rules
+func rewriteURL(rules []RewriteRule, name, url string) string {
+	for _, rule := range append(append([]RewriteRule{}, rules...), config.Rewrite...) {
+		if u, ok := rule.Apply(name, url); ok {
+			return u
+		}
+	}
+	return url
+}
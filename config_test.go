@@ -0,0 +1,62 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRewriteRuleApply(t *testing.T) {
+	cases := []struct {
+		rule     RewriteRule
+		name     string
+		url      string
+		expected string
+		ok       bool
+	}{
+		// Wildcards are matched against the import path
+		{RewriteRule{"github.com/*", "https://mirror.example.com/*.git"}, "github.com/foo/bar", "https://github.com/foo/bar", "https://mirror.example.com/foo/bar.git", true},
+		{RewriteRule{"github.com/*/tool", "git@example.com:*/tool.git"}, "github.com/foo/tool", "", "git@example.com:foo/tool.git", true},
+		{RewriteRule{"github.com/*", "https://mirror.example.com/*.git"}, "gitlab.com/foo/bar", "https://gitlab.com/foo/bar", "https://gitlab.com/foo/bar", false},
+		{RewriteRule{"github.com/*/tool", "git@example.com:*/tool.git"}, "github.com/tool", "", "", false},
+		// Exact import paths replace the url
+		{RewriteRule{"github.com/foo/bar", "https://mirror.example.com/bar.git"}, "github.com/foo/bar", "https://github.com/foo/bar", "https://mirror.example.com/bar.git", true},
+		{RewriteRule{"github.com/foo/bar", "https://mirror.example.com/bar.git"}, "github.com/foo/baz", "https://github.com/foo/baz", "https://github.com/foo/baz", false},
+		// Url prefixes are replaced
+		{RewriteRule{"git@github.com:", "https://github.com/"}, "github.com/foo/bar", "git@github.com:foo/bar", "https://github.com/foo/bar", true},
+		// Urls which were rewritten before are kept
+		{RewriteRule{"https://github.com/", "https://mirror.example.com/"}, "github.com/foo/bar", "https://mirror.example.com/foo/bar", "https://mirror.example.com/foo/bar", true},
+		// Incomplete rules are ignored
+		{RewriteRule{"", "https://mirror.example.com/"}, "github.com/foo/bar", "https://github.com/foo/bar", "https://github.com/foo/bar", false},
+		{RewriteRule{"github.com/*", ""}, "github.com/foo/bar", "https://github.com/foo/bar", "https://github.com/foo/bar", false},
+	}
+	for _, c := range cases {
+		url, ok := c.rule.Apply(c.name, c.url)
+		assert.Equal(t, c.expected, url, "Expected %v to rewrite %s of %s", c.rule, c.url, c.name)
+		assert.Equal(t, c.ok, ok, "Expected %v to match %s of %s: %t", c.rule, c.url, c.name, c.ok)
+	}
+}
+
+func TestRewriteURL(t *testing.T) {
+	defer func(rules []RewriteRule) { config.Rewrite = rules }(config.Rewrite)
+	config.Rewrite = []RewriteRule{
+		{"github.com/*", "https://global.example.com/*.git"},
+		{"gitlab.com/foo/bar", "https://global.example.com/bar.git"},
+	}
+	project := []RewriteRule{
+		{"github.com/foo/*", "https://project.example.com/*.git"},
+	}
+	cases := []struct {
+		name     string
+		url      string
+		expected string
+	}{
+		{"github.com/foo/bar", "https://github.com/foo/bar", "https://project.example.com/bar.git"},
+		{"github.com/baz/bar", "https://github.com/baz/bar", "https://global.example.com/baz/bar.git"},
+		{"gitlab.com/foo/bar", "https://gitlab.com/foo/bar", "https://global.example.com/bar.git"},
+		{"bitbucket.org/foo/bar", "https://bitbucket.org/foo/bar", "https://bitbucket.org/foo/bar"},
+	}
+	for _, c := range cases {
+		assert.Equal(t, c.expected, rewriteURL(project, c.name, c.url), "Expected the url of %s to be rewritten", c.name)
+	}
+}
@@ -0,0 +1,296 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/Masterminds/vcs"
+
+	semver "github.com/whitecypher/vgo/lib/version"
+)
+
+var (
+	// conflicts contains the names of repos of which the constraints conflicted during this run, so they're reported once
+	conflicts     = make(map[string]bool)
+	conflictsLock = sync.Mutex{}
+)
+
+// Constraint is the version of a repo required by one of it's dependents
+type Constraint struct {
+	Parent  string
+	Version Version
+}
+
+func (c Constraint) String() string {
+	return fmt.Sprintf("%s required by %s", c.Version, c.Parent)
+}
+
+// Constraints collects the versions required of the repo by the project and every dependency which declares it in
+// it's own manifest. Each dependent keeps it's own instance of the repo, so these are gathered across the graph.
+func (r *Repo) Constraints() []Constraint {
+	cs := []Constraint{}
+	seen := map[Constraint]bool{}
+	collect := func(d *Repo) {
+		parent := d.Parent()
+		if parent == nil {
+			return
+		}
+		parent.RLock()
+		c := Constraint{Parent: parent.Name}
+		parent.RUnlock()
+		d.RLock()
+		name := d.Name
+		c.Version = d.Version
+		d.RUnlock()
+		if name != r.Name || c.Version.Kind == VersionTypeNone || seen[c] {
+			return
+		}
+		seen[c] = true
+		cs = append(cs, c)
+	}
+	// The repo is included in case it isn't reachable from the project yet
+	collect(r)
+	r.Root().eachInstance(map[*Repo]bool{}, collect)
+	sort.Sort(constraints(cs))
+	return cs
+}
+
+// verifyConstraints resolves the kind of each version against the repo
+func verifyConstraints(repo vcs.Repo, cs []Constraint) []Constraint {
+	verified := make([]Constraint, len(cs))
+	for i, c := range cs {
+		verified[i] = Constraint{Parent: c.Parent, Version: verifyVersion(repo, c.Version)}
+	}
+	return verified
+}
+
+// satisfies checks whether the reference is compatible with all of the constraints
+func satisfies(repo vcs.Repo, ref string, cs []Constraint) bool {
+	info, err := repo.CommitInfo(ref)
+	if err != nil {
+		return false
+	}
+	for _, c := range cs {
+		// Tags are compared by name as the same commit may carry tags which don't match the constraint
+		if allowsTag(c.Version, ref) {
+			continue
+		}
+		if !isCompatibleReference(repo, c.Version, info.Commit) {
+			return false
+		}
+	}
+	return true
+}
+
+// resolveConstraints finds the newest reference in the repo compatible with all of the constraints. The newest
+// reference of each constraint is tried first, followed by all tags matching the version constraints from new to old.
+func resolveConstraints(repo vcs.Repo, name string, cs []Constraint) (string, error) {
+	if len(cs) == 0 {
+		return resolveReference(repo, NoVersion())
+	}
+	candidates := []string{}
+	ranges := []Version{}
+	for _, c := range cs {
+		if ref, err := resolveReference(repo, c.Version); err == nil {
+			candidates = append(candidates, ref)
+		}
+		if c.Version.Kind == VersionTypeSemVer {
+			ranges = append(ranges, c.Version)
+		}
+	}
+	if len(ranges) > 0 {
+		tags, _ := repo.Tags()
+		candidates = append(candidates, matchingTags(tags, ranges)...)
+	}
+	tried := map[string]bool{}
+	for _, ref := range candidates {
+		if tried[ref] {
+			continue
+		}
+		tried[ref] = true
+		if satisfies(repo, ref, cs) {
+			return ref, nil
+		}
+	}
+	return "", ConflictError{Name: name, Constraints: cs}
+}
+
+// matchingTags lists the tags compatible with all of the version constraints sorted from the newest to the oldest
+func matchingTags(tags []string, ranges []Version) []string {
+	matching := versionTags{}
+	for _, tag := range tags {
+		v, err := semver.ParseSemVer(tag)
+		if err != nil {
+			continue
+		}
+		ok := true
+		for _, r := range ranges {
+			ok = ok && allowsTag(r, tag)
+		}
+		if ok {
+			matching = append(matching, versionTag{tag, v})
+		}
+	}
+	sort.Sort(sort.Reverse(matching))
+	list := make([]string, len(matching))
+	for i, t := range matching {
+		list[i] = t.name
+	}
+	return list
+}
+
+// allowsTag checks whether the tag matches the version constraint
+func allowsTag(v Version, tag string) bool {
+	if v.Kind != VersionTypeSemVer {
+		return false
+	}
+	c, err := semver.ParseConstraint(v.Ref)
+	if err != nil {
+		return false
+	}
+	sv, err := semver.ParseSemVer(tag)
+	return err == nil && c.Check(sv)
+}
+
+// ConflictError is returned when no reference of a repo satisfies the versions required by all of it's dependents
+type ConflictError struct {
+	Name        string
+	Constraints []Constraint
+}
+
+func (e ConflictError) Error() string {
+	list := make([]string, len(e.Constraints))
+	for i, c := range e.Constraints {
+		list[i] = c.String()
+	}
+	return fmt.Sprintf("No reference of %s satisfies %s", e.Name, strings.Join(list, ", "))
+}
+
+// constrain checks the checkout of the repo, which may have been installed for another dependent already, against all
+// constraints and resolves a new reference when it isn't compatible
+func (r *Repo) constrain() error {
+	l := installLock(r.Name)
+	l.Lock()
+	defer l.Unlock()
+	conflictsLock.Lock()
+	conflicted := conflicts[r.Name]
+	conflictsLock.Unlock()
+	if conflicted {
+		return nil
+	}
+	repo, ref, err := r.installedReference()
+	if repo == nil || err != nil {
+		// The repo is resolved with all constraints once installed
+		return err
+	}
+	cs := verifyConstraints(repo, r.Constraints())
+	if satisfies(repo, ref, cs) {
+		return nil
+	}
+	Logf(strings.Repeat("  ", r.Depth()-1)+"WARN Reference %s of %s is not compatible with all dependents, resolving again", shortReference(ref), r.Name)
+	r.Lock()
+	r.Reference = ""
+	r.Unlock()
+	err = r.Checkout(false)
+	if _, ok := err.(ConflictError); ok {
+		conflictsLock.Lock()
+		conflicts[r.Name] = true
+		conflictsLock.Unlock()
+	}
+	return err
+}
+
+// checkVersion checks whether any reference of the installed repo satisfies the version as required by the project
+// together with the versions required by all other dependents, without changing the checkout. Repos which aren't
+// installed yet are resolved with all constraints when installing them.
+func (r *Repo) checkVersion(v Version) error {
+	root := r.Root()
+	cs := []Constraint{{Parent: root.Name, Version: v}}
+	for _, c := range r.Constraints() {
+		if c.Parent != root.Name {
+			cs = append(cs, c)
+		}
+	}
+	if len(cs) == 1 {
+		return nil
+	}
+	repo, _, err := r.installedReference()
+	if repo == nil || err != nil {
+		return err
+	}
+	sort.Sort(constraints(cs))
+	_, err = resolveConstraints(repo, r.Name, verifyConstraints(repo, cs))
+	return err
+}
+
+// installedReference resolves the reference the repo is installed at. Exported dependencies have no metadata, so the
+// commit exported for any of the instances of the repo is read from the mirror instead. No repo is returned when the
+// repo isn't installed yet.
+func (r *Repo) installedReference() (vcs.Repo, string, error) {
+	if !r.isExported() {
+		repo := repoFromPath(r.Path())
+		if repo == nil {
+			return nil, "", nil
+		}
+		ref, err := repo.Version()
+		return repo, ref, err
+	}
+	ref := ""
+	find := func(d *Repo) {
+		d.RLock()
+		if len(ref) == 0 && d.Name == r.Name {
+			ref = d.Reference
+		}
+		d.RUnlock()
+	}
+	find(r)
+	r.Root().eachInstance(map[*Repo]bool{}, find)
+	if _, err := os.Stat(r.Path()); err != nil || len(ref) == 0 {
+		return nil, "", nil
+	}
+	repo, err := r.VCS()
+	if err != nil || !repo.CheckLocal() {
+		return nil, "", err
+	}
+	return repo, ref, nil
+}
+
+// shareReference applies the checked out reference of the repo to the instances of it's other dependents
+func (r *Repo) shareReference() {
+	r.RLock()
+	ref, hash, files := r.Reference, r.hash, r.files
+	r.RUnlock()
+	r.Root().eachInstance(map[*Repo]bool{}, func(d *Repo) {
+		if d == r {
+			return
+		}
+		d.Lock()
+		if d.Name == r.Name {
+			d.Reference, d.hash, d.files = ref, hash, files
+		}
+		d.Unlock()
+	})
+}
+
+// constraints sorts constraints by the name of the dependent
+type constraints []Constraint
+
+func (c constraints) Len() int           { return len(c) }
+func (c constraints) Less(i, j int) bool { return c[i].Parent < c[j].Parent }
+func (c constraints) Swap(i, j int)      { c[i], c[j] = c[j], c[i] }
+
+// versionTag is a tag with it's parsed semantic version
+type versionTag struct {
+	name    string
+	version semver.SemVer
+}
+
+// versionTags sorts tags by their semantic version
+type versionTags []versionTag
+
+func (t versionTags) Len() int           { return len(t) }
+func (t versionTags) Less(i, j int) bool { return t[i].version.Compare(t[j].version) < 0 }
+func (t versionTags) Swap(i, j int)      { t[i], t[j] = t[j], t[i] }
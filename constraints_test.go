@@ -0,0 +1,176 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Masterminds/vcs"
+	"github.com/stretchr/testify/assert"
+)
+
+// gitRepo creates a git repo in a temporary directory with a commit for each of the tags
+func gitRepo(t *testing.T, tags ...string) vcs.Repo {
+	dir, _ := ioutil.TempDir("", "constraints")
+	git := func(args ...string) {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		cmd.Env = append(os.Environ(), "GIT_AUTHOR_NAME=vgo", "GIT_AUTHOR_EMAIL=vgo@example.com",
+			"GIT_COMMITTER_NAME=vgo", "GIT_COMMITTER_EMAIL=vgo@example.com")
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v failed with %s: %s", args, err, out)
+		}
+	}
+	git("init", "--quiet")
+	git("checkout", "--quiet", "-b", "master")
+	git("remote", "add", "origin", dir)
+	for _, tag := range tags {
+		ioutil.WriteFile(filepath.Join(dir, "version"), []byte(tag), 0644)
+		git("add", "version")
+		git("commit", "--quiet", "-m", tag)
+		git("tag", tag)
+	}
+	repo, err := vcs.NewGitRepo(dir, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return repo
+}
+
+func TestMatchingTags(t *testing.T) {
+	tags := []string{"v1.0.0", "v1.1.0", "v1.2.0-beta.1", "v1.2.0", "v2.0.0", "v2.1.0-rc.1", "latest", "release-1"}
+	cases := []struct {
+		ranges   []string
+		expected []string
+	}{
+		{[]string{"^1"}, []string{"v1.2.0", "v1.1.0", "v1.0.0"}},
+		{[]string{"^1", "~1.1"}, []string{"v1.1.0"}},
+		{[]string{">=1.1", "<2"}, []string{"v1.2.0", "v1.1.0"}},
+		{[]string{"1.x", "^1.1"}, []string{"v1.2.0", "v1.1.0"}},
+		{[]string{"^1", "^2"}, []string{}},
+		{[]string{"^1.2.0-beta.1"}, []string{"v1.2.0", "v1.2.0-beta.1"}},
+		{[]string{"^1.2.0-beta.1", "~1.1"}, []string{}},
+		{[]string{">=2.1.0-rc.1"}, []string{"v2.1.0-rc.1"}},
+	}
+	for _, c := range cases {
+		ranges := make([]Version, len(c.ranges))
+		for i, r := range c.ranges {
+			ranges[i] = VersionFromString(r)
+		}
+		assert.Equal(t, c.expected, matchingTags(tags, ranges), "Expected the tags matching %v", c.ranges)
+	}
+}
+
+func TestAllowsTag(t *testing.T) {
+	cases := []struct {
+		version  Version
+		tag      string
+		expected bool
+	}{
+		{VersionFromString("^1.1"), "v1.4.2", true},
+		{VersionFromString("^1.1"), "1.4.2", true},
+		{VersionFromString("^1.1"), "v1.0.9", false},
+		{VersionFromString("^1.1"), "v2.0.0", false},
+		{VersionFromString("~1.2"), "v1.2.9", true},
+		{VersionFromString("~1.2"), "v1.3.0", false},
+		{VersionFromString("^1.1"), "v1.5.0-beta.1", false},
+		{VersionFromString("^1.5.0-beta.1"), "v1.5.0-beta.2", true},
+		{VersionFromString("^1.5.0-beta.1"), "v1.6.0-beta.1", false},
+		{VersionFromString("^1"), "latest", false},
+		{VersionFromString("^1"), "release-1", false},
+		{VersionFromString("master"), "v1.0.0", false},
+		{Version{Kind: VersionTypeTag, Ref: "v1.0.0"}, "v1.0.0", false},
+		{NoVersion(), "v1.0.0", false},
+	}
+	for _, c := range cases {
+		assert.Equal(t, c.expected, allowsTag(c.version, c.tag), "Expected %s to allow %s: %v", c.version, c.tag, c.expected)
+	}
+}
+
+func TestResolveConstraints(t *testing.T) {
+	assert := assert.New(t)
+	repo := gitRepo(t, "v1.0.0", "v1.1.0", "v2.0.0")
+	defer os.RemoveAll(repo.LocalPath())
+
+	ref, err := resolveConstraints(repo, "example.com/lib", []Constraint{
+		{Parent: "example.com/a", Version: VersionFromString("^1")},
+		{Parent: "example.com/b", Version: VersionFromString("~1.0")},
+	})
+	assert.Nil(err)
+	assert.Equal("v1.0.0", ref, "Expected the newest tag allowed by both constraints")
+
+	ref, err = resolveConstraints(repo, "example.com/lib", []Constraint{
+		{Parent: "example.com/a", Version: VersionFromString("^1")},
+		{Parent: "example.com/b", Version: Version{Kind: VersionTypeBranch, Ref: "master"}},
+	})
+	assert.Nil(err)
+	assert.Equal("v1.1.0", ref, "Expected a tag on the branch to satisfy both constraints")
+
+	cs := []Constraint{
+		{Parent: "example.com/a", Version: VersionFromString("^1")},
+		{Parent: "example.com/b", Version: VersionFromString("^2")},
+	}
+	_, err = resolveConstraints(repo, "example.com/lib", cs)
+	assert.Equal(ConflictError{Name: "example.com/lib", Constraints: cs}, err)
+	assert.Equal("No reference of example.com/lib satisfies ^1 required by example.com/a, ^2 required by example.com/b", err.Error())
+}
+
+func TestConstrainExported(t *testing.T) {
+	assert := assert.New(t)
+	upstream := gitRepo(t, "v1.0.0", "v1.1.0")
+	defer os.RemoveAll(upstream.LocalPath())
+	dir, _ := ioutil.TempDir("", "constraints")
+	defer os.RemoveAll(dir)
+	defer func(wd, cache string) {
+		cwd = wd
+		os.Setenv("VGO_CACHE", cache)
+	}(cwd, os.Getenv("VGO_CACHE"))
+	cwd = dir
+	os.Setenv("VGO_CACHE", filepath.Join(dir, "cache"))
+	v10, _ := upstream.RunFromDir("git", "rev-parse", "v1.0.0")
+	v11, _ := upstream.RunFromDir("git", "rev-parse", "v1.1.0")
+
+	root := &Repo{Name: "example.com/project", Export: true}
+	lib := &Repo{Name: "github.com/test/lib", Version: VersionFromString("^1"), URL: upstream.LocalPath(), parent: root}
+	root.Dependencies = []*Repo{lib}
+	assert.Nil(lib.Install())
+	assert.Equal(strings.TrimSpace(string(v11)), lib.Reference)
+
+	// A dependent requiring an older version is discovered after the repo was exported
+	dep := &Repo{Name: "github.com/test/dep", parent: root}
+	depLib := &Repo{Name: "github.com/test/lib", Version: VersionFromString("~1.0"), URL: upstream.LocalPath(), parent: dep}
+	dep.Dependencies = []*Repo{depLib}
+	root.Dependencies = append(root.Dependencies, dep)
+	assert.Nil(depLib.constrain())
+	assert.Equal(strings.TrimSpace(string(v10)), lib.Reference, "Expected the export to satisfy all dependents")
+	assert.Equal(lib.Reference, depLib.Reference)
+}
+
+func TestCheckVersion(t *testing.T) {
+	assert := assert.New(t)
+	upstream := gitRepo(t, "v1.0.0", "v1.1.0")
+	defer os.RemoveAll(upstream.LocalPath())
+	dir, _ := ioutil.TempDir("", "constraints")
+	defer os.RemoveAll(dir)
+	defer func(wd string) { cwd = wd }(cwd)
+	cwd = dir
+	out, err := exec.Command("git", "clone", "--quiet", upstream.LocalPath(), filepath.Join(dir, "vendor", "github.com", "test", "lib")).CombinedOutput()
+	if err != nil {
+		t.Fatalf("git clone failed with %s: %s", err, out)
+	}
+
+	root := &Repo{Name: "example.com/project"}
+	lib := &Repo{Name: "github.com/test/lib", Version: VersionFromString("^1.0"), parent: root}
+	dep := &Repo{Name: "github.com/test/dep", parent: root}
+	dep.Dependencies = []*Repo{{Name: "github.com/test/lib", Version: VersionFromString("~1.0"), parent: dep}}
+	root.Dependencies = []*Repo{lib, dep}
+
+	assert.Nil(lib.checkVersion(VersionFromString("~1.0.0")))
+	err = lib.checkVersion(VersionFromString("^1.1"))
+	assert.IsType(ConflictError{}, err)
+	assert.Equal("No reference of github.com/test/lib satisfies ^1.1 required by example.com/project, ~1.0 required by github.com/test/dep", err.Error())
+	assert.Nil((&Repo{Name: "github.com/test/other", parent: root}).checkVersion(VersionFromString("^2")), "Expected repos without other dependents to be accepted")
+}
@@ -0,0 +1,271 @@
+package main
+
+import (
+	"archive/tar"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/Masterminds/vcs"
+	"github.com/whitecypher/vgo/lib/checksum"
+)
+
+// isExported returns whether dependencies are vendored as plain files without version control metadata
+func (r *Repo) isExported() bool {
+	return r.Root().Export
+}
+
+// export installs the repo as a plain copy of the reference from it's mirror, the counterpart of Checkout for exported
+// dependencies. The vendored files are compared with the checksums in the lock file to detect local changes.
+func (r *Repo) export(update bool) error {
+	repo, err := r.VCS()
+	if err != nil {
+		return err
+	}
+	indent := strings.Repeat("  ", r.Depth()-1)
+	// The versions required by all dependents are gathered before locking the repo, as it is one of them
+	cs := verifyConstraints(repo, r.Constraints())
+	r.Lock()
+	path := r.Path()
+	_, statErr := os.Stat(path)
+	exists := statErr == nil
+	if exists && r.exportDirty() {
+		r.Unlock()
+		Logf(indent+"NOOP Skipping export for %s. Dependency is dirty.", r.Name)
+		return fmt.Errorf("Dependency %s is dirty", r.Name)
+	}
+	r.Version = verifyVersion(repo, r.Version)
+	// Locked references are exported as is, only updates resolve a new reference
+	ref := r.Reference
+	if len(ref) > 0 && !update && r.mirror.HasReference(ref) && !satisfies(repo, ref, cs) {
+		Logf(indent+"WARN Reference %s of %s is not compatible with all dependents, resolving again", shortReference(ref), r.Name)
+		ref = ""
+	}
+	if update || len(ref) == 0 {
+		if update {
+			err = r.pull(repo, "")
+		}
+		if err == nil {
+			ref, err = resolveConstraints(repo, r.Name, cs)
+		}
+	} else if !r.mirror.HasReference(ref) {
+		// The locked reference may have been resolved elsewhere and not be fetched yet
+		err = r.pull(repo, ref)
+	}
+	var commit string
+	if err == nil {
+		commit, err = r.mirror.Commit(ref)
+	}
+	if err != nil {
+		r.Unlock()
+		Logf(indent+"FAIL %s", err.Error())
+		return err
+	}
+	if !exists || commit != r.Reference {
+		err = os.RemoveAll(path)
+		if err == nil {
+			err = r.mirror.Export(commit, path)
+		}
+		if err != nil {
+			r.Unlock()
+			Logf(indent+"FAIL Export failed with error %s", err.Error())
+			return err
+		}
+	}
+	// Metadata left behind by a previous checkout of the repo
+	for _, d := range []string{".git", ".hg", ".bzr", ".svn"} {
+		os.RemoveAll(filepath.Join(path, d))
+	}
+	r.Reference = commit
+	r.files, err = checksum.Files(path)
+	r.hash = checksum.Sum(r.files)
+	Logf(indent+"OK %s %s", r.Reference, r.Name)
+	r.Unlock()
+	r.shareReference()
+	r.LoadManifest()
+	r.InstallDeps()
+	return err
+}
+
+// exportDirty checks whether the vendored files differ from the checksum in the lock file
+func (r *Repo) exportDirty() bool {
+	if len(r.hash) == 0 {
+		return false
+	}
+	sum, err := checksum.Dir(r.Path())
+	return err != nil || sum != r.hash
+}
+
+// removeExport removes an exported copy of the repo so it can be replaced by a checkout, unless it has local changes
+func (r *Repo) removeExport() error {
+	path := r.Path()
+	if _, err := os.Stat(path); err != nil {
+		return nil
+	}
+	if r.exportDirty() {
+		return fmt.Errorf("Dependency %s is dirty", r.Name)
+	}
+	return os.RemoveAll(path)
+}
+
+// vendorState inspects the vendored copy of the repo. It returns the repo to read references from, which is the mirror
+// for exported dependencies, and whether the copy is missing or has local changes.
+func (r *Repo) vendorState() (repo vcs.Repo, missing, dirty bool) {
+	if !r.isExported() {
+		repo = repoFromPath(r.Path())
+		if repo == nil {
+			return nil, true, false
+		}
+		return repo, false, isDirty(repo)
+	}
+	if _, err := os.Stat(r.Path()); err != nil {
+		missing = true
+	} else {
+		dirty = r.exportDirty()
+	}
+	if l, ok := locked[r.Name]; ok && len(l.URL) > 0 {
+		if m := NewMirror(l.Type, l.URL); m != nil && m.Exists() {
+			repo, _ = m.vcsRepo()
+		}
+	}
+	return
+}
+
+// bareGitRepo adapts a vcs.Repo to a bare git mirror, in which branches are local heads instead of remote branches
+type bareGitRepo struct {
+	vcs.Repo
+}
+
+// Branches lists the branches of the mirror
+func (b *bareGitRepo) Branches() ([]string, error) {
+	out, err := b.RunFromDir("git", "for-each-ref", "--format=%(refname:short)", "refs/heads")
+	if err != nil {
+		return []string{}, err
+	}
+	return strings.Fields(string(out)), nil
+}
+
+// CheckLocal verifies the mirror exists
+func (b *bareGitRepo) CheckLocal() bool {
+	_, err := os.Stat(filepath.Join(b.LocalPath(), "HEAD"))
+	return err == nil
+}
+
+// vcsRepo opens the mirror as a vcs.Repo to read references from
+func (m *Mirror) vcsRepo() (vcs.Repo, error) {
+	repo, err := newVCSRepo(m.Type, m.URL, m.Path)
+	if err == vcs.ErrWrongRemote {
+		// The mirror was cloned from a url with another scheme or user
+		if m.Type == vcs.Git {
+			err = m.setRemote()
+			if err != nil {
+				return nil, err
+			}
+			repo, err = newVCSRepo(m.Type, m.URL, m.Path)
+		} else {
+			repo, err = newVCSRepo(m.Type, "", m.Path)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	if m.Type == vcs.Git {
+		return &bareGitRepo{repo}, nil
+	}
+	return repo, nil
+}
+
+// Commit resolves the reference to the full commit hash
+func (m *Mirror) Commit(ref string) (string, error) {
+	var out []byte
+	var err error
+	switch m.Type {
+	case vcs.Git:
+		out, err = m.output(m.Path, "git", "rev-parse", "--verify", ref+"^{commit}")
+	case vcs.Hg:
+		out, err = m.output(m.Path, "hg", "log", "-r", ref, "--template", "{node}")
+	default:
+		err = fmt.Errorf("Unable to resolve %s in %s", ref, m.URL)
+	}
+	return strings.TrimSpace(string(out)), err
+}
+
+// Export writes the files of the commit to dir without any version control metadata
+func (m *Mirror) Export(commit, dir string) error {
+	switch m.Type {
+	case vcs.Git:
+		cmd := exec.Command("git", "archive", "--format=tar", commit)
+		cmd.Dir = m.Path
+		out, err := cmd.StdoutPipe()
+		if err != nil {
+			return err
+		}
+		err = cmd.Start()
+		if err != nil {
+			return err
+		}
+		err = untar(out, dir)
+		if e := cmd.Wait(); err == nil {
+			err = e
+		}
+		return err
+	case vcs.Hg:
+		err := m.run(m.Path, "hg", "archive", "-r", commit, "-t", "files", dir)
+		if err != nil {
+			return err
+		}
+		return os.Remove(filepath.Join(dir, ".hg_archival.txt"))
+	}
+	return fmt.Errorf("Unable to export %s", m.URL)
+}
+
+// untar extracts the archive into dir
+func untar(r io.Reader, dir string) error {
+	tr := tar.NewReader(r)
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		path := filepath.Join(dir, filepath.FromSlash(h.Name))
+		if !strings.HasPrefix(path, filepath.Clean(dir)+string(filepath.Separator)) {
+			return fmt.Errorf("Invalid path %s in archive", h.Name)
+		}
+		switch h.Typeflag {
+		case tar.TypeDir:
+			err = os.MkdirAll(path, os.FileMode(0755))
+		case tar.TypeReg, tar.TypeRegA:
+			err = writeFile(path, tr, os.FileMode(h.Mode).Perm())
+		case tar.TypeSymlink:
+			err = os.MkdirAll(filepath.Dir(path), os.FileMode(0755))
+			if err == nil {
+				err = os.Symlink(h.Linkname, path)
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func writeFile(path string, r io.Reader, mode os.FileMode) error {
+	err := os.MkdirAll(filepath.Dir(path), os.FileMode(0755))
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, mode)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(f, r)
+	if e := f.Close(); err == nil {
+		err = e
+	}
+	return err
+}
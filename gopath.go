@@ -0,0 +1,66 @@
+package main
+
+import (
+	"go/build"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// overlayDir is the directory within projects outside of the GOPATH holding the GOPATH overlay
+const overlayDir = ".vgo"
+
+// gopathName returns the import path of the dir derived from it's location in the GOPATH
+func gopathName(dir string) (string, bool) {
+	for _, p := range filepath.SplitList(gopath) {
+		src := filepath.Join(p, "src")
+		if strings.HasPrefix(dir, src+string(filepath.Separator)) {
+			name, err := filepath.Rel(src, dir)
+			if err == nil {
+				return filepath.ToSlash(name), true
+			}
+		}
+	}
+	return "", false
+}
+
+// setupOverlay links the project into a GOPATH overlay within it's overlay directory so it can be imported by name and
+// it's vendor directory is used. The overlay is prepended to the GOPATH used to import packages and by the go commands
+// run by vgo, and the path of the project within the overlay is returned.
+func setupOverlay(dir, name string) (string, error) {
+	overlay := filepath.Join(dir, overlayDir)
+	link := filepath.Join(overlay, "src", filepath.FromSlash(name))
+	if target, err := os.Readlink(link); err != nil || target != dir {
+		err = os.RemoveAll(link)
+		if err == nil {
+			err = os.MkdirAll(filepath.Dir(link), os.FileMode(0755))
+		}
+		if err == nil {
+			err = os.Symlink(dir, link)
+		}
+		if err == nil {
+			// The overlay is generated and never committed
+			err = ioutil.WriteFile(filepath.Join(overlay, ".gitignore"), []byte("*\n"), os.FileMode(0644))
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+	paths := []string{overlay}
+	if len(gopath) > 0 {
+		paths = append(paths, gopath)
+	}
+	gosrcpath = filepath.Join(overlay, "src")
+	build.Default.GOPATH = strings.Join(paths, string(filepath.ListSeparator))
+	err := os.Setenv("GOPATH", build.Default.GOPATH)
+	if err != nil {
+		return "", err
+	}
+	// The go command resolves the working directory from PWD as long as it points to the same directory
+	err = os.Chdir(link)
+	if err == nil {
+		err = os.Setenv("PWD", link)
+	}
+	return link, err
+}
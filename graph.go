@@ -0,0 +1,249 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"go/build"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/whitecypher/vgo/lib/native"
+)
+
+// Graph is the dependency graph of the project at repo or package level
+type Graph struct {
+	Nodes []*GraphNode `json:"nodes"`
+	Edges []*GraphEdge `json:"edges"`
+}
+
+// GraphNode is a repo or package with the version and reference of it's repo
+type GraphNode struct {
+	Name    string `json:"name"`
+	Repo    string `json:"repo,omitempty"`
+	Version string `json:"version,omitempty"`
+	Ref     string `json:"ref,omitempty"`
+}
+
+// GraphEdge is a dependency between two nodes. Edges between repos list the packages which import the dependency.
+type GraphEdge struct {
+	From     string   `json:"from"`
+	To       string   `json:"to"`
+	Packages []string `json:"packages,omitempty"`
+}
+
+// Graph builds the dependency graph of the repo from the manifest and the imports of the main packages. The graph
+// contains packages instead of repos when packages is set.
+func (r *Repo) Graph(packages bool) *Graph {
+	repos := map[string]*Repo{}
+	r.walk(repos)
+	imports := r.packageImports(false)
+
+	g := &Graph{}
+	if packages {
+		for pkg, deps := range imports {
+			g.Nodes = append(g.Nodes, repoNode(pkg, repos))
+			for _, dep := range deps {
+				g.Edges = append(g.Edges, &GraphEdge{From: pkg, To: dep})
+			}
+		}
+		g.sort()
+		return g
+	}
+
+	edges := map[[2]string]*GraphEdge{}
+	for name, d := range repos {
+		g.Nodes = append(g.Nodes, repoNode(name, repos))
+		for _, dep := range d.Dependencies {
+			edges[[2]string{name, dep.Name}] = &GraphEdge{From: name, To: dep.Name}
+		}
+	}
+	for pkg, deps := range imports {
+		from := repoRoots.Root(pkg)
+		for _, dep := range deps {
+			to := repoRoots.Root(dep)
+			if from == to {
+				continue
+			}
+			e, ok := edges[[2]string{from, to}]
+			if !ok {
+				e = &GraphEdge{From: from, To: to}
+				edges[[2]string{from, to}] = e
+			}
+			if len(e.Packages) == 0 || e.Packages[len(e.Packages)-1] != pkg {
+				e.Packages = append(e.Packages, pkg)
+			}
+		}
+	}
+	for _, e := range edges {
+		g.Edges = append(g.Edges, e)
+		// Repos which are imported but missing from the manifest
+		for _, name := range []string{e.From, e.To} {
+			if _, ok := repos[name]; !ok {
+				repos[name] = nil
+				g.Nodes = append(g.Nodes, repoNode(name, repos))
+			}
+		}
+	}
+	g.sort()
+	return g
+}
+
+// repoNode creates the node of a repo or package including the version and reference of it's repo
+func repoNode(name string, repos map[string]*Repo) *GraphNode {
+	n := &GraphNode{Name: name}
+	root := repoRoots.Root(name)
+	if root != name {
+		n.Repo = root
+	}
+	if d, ok := repos[root]; ok && d != nil && !d.IsRoot() {
+		d.RLock()
+		n.Version = d.Version.String()
+		n.Ref = d.Reference
+		d.RUnlock()
+	}
+	return n
+}
+
+// packageImports collects the non standard library imports of all packages reachable from the main packages in any of
+// the build contexts by their import path, excluding vendor prefixes. The test imports of the main packages are
+// included when tests is set.
+func (r *Repo) packageImports(tests bool) map[string][]string {
+	imports := map[string][]string{}
+	for _, ctxt := range r.BuildContexts() {
+		for name, deps := range ctxt.packageImports(r.MainPkgs(ctxt), tests) {
+			imports[name] = uniqueStrings(append(imports[name], deps...))
+		}
+	}
+	return imports
+}
+
+// packageImports collects the imports of all packages reachable from the given packages in the build context
+func (ctxt *BuildContext) packageImports(starts []*build.Package, tests bool) map[string][]string {
+	imports := map[string][]string{}
+	queue := append([]*build.Package{}, starts...)
+	for n := 0; len(queue) > 0; n++ {
+		bp := queue[0]
+		queue = queue[1:]
+		name := importName(bp.ImportPath)
+		if _, ok := imports[name]; ok && n >= len(starts) {
+			continue
+		}
+		paths := bp.Imports
+		if tests && n < len(starts) {
+			paths = append(append(append([]string{}, paths...), bp.TestImports...), bp.XTestImports...)
+		}
+		deps := imports[name]
+		for _, i := range paths {
+			if i == "C" || native.IsNative(i) {
+				continue
+			}
+			dep, err := ctxt.Import(i, bp.Dir, build.ImportMode(0))
+			if err != nil && dep.Dir == "" {
+				continue
+			}
+			deps = append(deps, importName(dep.ImportPath))
+			queue = append(queue, dep)
+		}
+		imports[name] = uniqueStrings(deps)
+	}
+	return imports
+}
+
+// sort orders nodes and edges by name for stable output
+func (g *Graph) sort() {
+	sort.Sort(graphNodes(g.Nodes))
+	sort.Sort(graphEdges(g.Edges))
+	for _, e := range g.Edges {
+		sort.Strings(e.Packages)
+	}
+}
+
+// label describes the node by it's name, version and abbreviated reference
+func (n *GraphNode) label() []string {
+	l := []string{n.Name}
+	v := strings.TrimSpace(n.Version + " " + shortReference(n.Ref))
+	if len(v) > 0 {
+		l = append(l, v)
+	}
+	return l
+}
+
+// Write the graph in the given format, one of dot, json or mermaid
+func (g *Graph) Write(w io.Writer, format string) error {
+	switch format {
+	case "dot":
+		return g.writeDOT(w)
+	case "json":
+		data, err := json.MarshalIndent(g, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(w, string(data))
+		return err
+	case "mermaid":
+		return g.writeMermaid(w)
+	}
+	return fmt.Errorf("Unknown graph format %s, expected dot, json or mermaid", format)
+}
+
+func (g *Graph) writeDOT(w io.Writer) error {
+	fmt.Fprintln(w, "digraph vgo {")
+	for _, n := range g.Nodes {
+		fmt.Fprintf(w, "  %q [label=%q];\n", n.Name, strings.Join(n.label(), "\n"))
+	}
+	for _, e := range g.Edges {
+		if len(e.Packages) > 0 {
+			fmt.Fprintf(w, "  %q -> %q [label=%q];\n", e.From, e.To, strings.Join(e.Packages, "\n"))
+			continue
+		}
+		fmt.Fprintf(w, "  %q -> %q;\n", e.From, e.To)
+	}
+	_, err := fmt.Fprintln(w, "}")
+	return err
+}
+
+func (g *Graph) writeMermaid(w io.Writer) error {
+	ids := map[string]string{}
+	fmt.Fprintln(w, "graph LR")
+	for i, n := range g.Nodes {
+		ids[n.Name] = fmt.Sprintf("n%d", i)
+		fmt.Fprintf(w, "  %s[\"%s\"]\n", ids[n.Name], mermaidEscape(strings.Join(n.label(), "<br/>")))
+	}
+	for _, e := range g.Edges {
+		from, to := ids[e.From], ids[e.To]
+		if len(from) == 0 || len(to) == 0 {
+			continue
+		}
+		if len(e.Packages) > 0 {
+			fmt.Fprintf(w, "  %s -->|\"%s\"| %s\n", from, mermaidEscape(strings.Join(e.Packages, "<br/>")), to)
+			continue
+		}
+		fmt.Fprintf(w, "  %s --> %s\n", from, to)
+	}
+	return nil
+}
+
+// mermaidEscape replaces quotes which would end a mermaid label
+func mermaidEscape(s string) string {
+	return strings.Replace(s, `"`, "#quot;", -1)
+}
+
+// graphNodes sorts nodes by name
+type graphNodes []*GraphNode
+
+func (n graphNodes) Len() int           { return len(n) }
+func (n graphNodes) Less(i, j int) bool { return n[i].Name < n[j].Name }
+func (n graphNodes) Swap(i, j int)      { n[i], n[j] = n[j], n[i] }
+
+// graphEdges sorts edges by the names of the nodes they connect
+type graphEdges []*GraphEdge
+
+func (e graphEdges) Len() int { return len(e) }
+func (e graphEdges) Less(i, j int) bool {
+	if e[i].From != e[j].From {
+		return e[i].From < e[j].From
+	}
+	return e[i].To < e[j].To
+}
+func (e graphEdges) Swap(i, j int) { e[i], e[j] = e[j], e[i] }
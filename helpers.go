@@ -3,6 +3,9 @@ package main
 import (
 	"fmt"
 	"os"
+	"path/filepath"
+	"sort"
+	"strings"
 
 	"github.com/Masterminds/vcs"
 )
@@ -21,6 +24,37 @@ func resolveManifestFilePath(dir string) string {
 	return filepath.Join(dir, "vgo.yaml")
 }
 
+// parseDependency splits a {packagename}[#{version|branch|tag|commit}] argument into it's name and version
+func parseDependency(arg string) (string, Version) {
+	parts := strings.SplitN(arg, "#", 2)
+	if len(parts) == 1 {
+		return parts[0], NoVersion()
+	}
+	return parts[0], VersionFromString(parts[1])
+}
+
+// removeEmptyDirs removes dir and it's parents for as long as they are empty, stopping at the stop dir
+func removeEmptyDirs(dir, stop string) {
+	for strings.HasPrefix(dir, stop) && dir != stop {
+		if os.Remove(dir) != nil {
+			return
+		}
+		dir = filepath.Dir(dir)
+	}
+}
+
+// uniqueStrings sorts the list and removes duplicates
+func uniqueStrings(list []string) []string {
+	sort.Strings(list)
+	unique := list[:0]
+	for i, s := range list {
+		if i == 0 || s != list[i-1] {
+			unique = append(unique, s)
+		}
+	}
+	return unique
+}
+
 // PackageRepoMapper maps packages to repositories
 // func PackageRepoMapper(p *Pkg, d *Pkg) {
 // 	pr := NewRepo(p.RepoName())
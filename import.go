@@ -0,0 +1,400 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/Masterminds/vcs"
+	"gopkg.in/yaml.v2"
+
+	"github.com/whitecypher/vgo/lib/gomod"
+	"github.com/whitecypher/vgo/lib/toml"
+	semver "github.com/whitecypher/vgo/lib/version"
+)
+
+var (
+	// importFormats lists the formats of other dependency tools with the files they are detected by, in order of
+	// preference when a project contains several of them
+	importFormats = []struct {
+		name  string
+		files []string
+	}{
+		{"dep", []string{"Gopkg.toml", "Gopkg.lock"}},
+		{"glide", []string{"glide.yaml", "glide.lock"}},
+		{"godep", []string{filepath.Join("Godeps", "Godeps.json")}},
+		{"govendor", []string{filepath.Join("vendor", "vendor.json")}},
+		{"gomod", []string{"go.mod"}},
+	}
+	// regexDescribe matches the suffix git describe adds to tags for commits after the tag e.g. v1.2.0-3-gabc1234
+	regexDescribe = regexp.MustCompile(`-\d+-g[0-9a-f]+$`)
+)
+
+// ImportedRepo is a dependency read from the manifest and lock files of another dependency tool
+type ImportedRepo struct {
+	Name      string
+	URL       string
+	Type      vcs.Type
+	Version   Version
+	Reference string
+}
+
+// importedRepos collects imported repos by name in the order they were first added
+type importedRepos struct {
+	list   []*ImportedRepo
+	byName map[string]*ImportedRepo
+}
+
+func newImportedRepos() *importedRepos {
+	return &importedRepos{byName: map[string]*ImportedRepo{}}
+}
+
+// add returns the imported repo of the name, adding it if it doesn't exist yet
+func (s *importedRepos) add(name string) *ImportedRepo {
+	if i, ok := s.byName[name]; ok {
+		return i
+	}
+	i := &ImportedRepo{Name: name, Version: NoVersion()}
+	s.byName[name] = i
+	s.list = append(s.list, i)
+	return i
+}
+
+// lock sets the reference of the imported repo unless it's packages were pinned to another reference already
+func (i *ImportedRepo) lock(ref string) {
+	if len(i.Reference) > 0 && i.Reference != ref {
+		Logf("WARN Packages of %s are pinned to different references, using %s", i.Name, i.Reference)
+		return
+	}
+	i.Reference = ref
+}
+
+// DetectImportFormat finds the format of the first dependency tool of which files exist in dir
+func DetectImportFormat(dir string) (string, error) {
+	for _, f := range importFormats {
+		for _, file := range f.files {
+			if _, err := os.Stat(filepath.Join(dir, file)); err == nil {
+				return f.name, nil
+			}
+		}
+	}
+	return "", fmt.Errorf("No manifest of dep, glide, godep, govendor or go modules found in %s", dir)
+}
+
+// ReadImport reads the dependencies from the manifest and lock files of the format in dir
+func ReadImport(dir, format string) ([]*ImportedRepo, error) {
+	var repos *importedRepos
+	var err error
+	switch format {
+	case "dep":
+		repos, err = readDep(dir)
+	case "glide":
+		repos, err = readGlide(dir)
+	case "godep":
+		repos, err = readGodep(dir)
+	case "govendor":
+		repos, err = readGovendor(dir)
+	case "gomod":
+		repos, err = readGomod(dir)
+	default:
+		return nil, fmt.Errorf("Unknown import format %s, expected dep, glide, godep, govendor or gomod", format)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return repos.list, nil
+}
+
+// Import adds the imported dependencies to the repo, replacing the version and url of existing dependencies, and locks
+// them to the imported references
+func (r *Repo) Import(imported []*ImportedRepo) {
+	for _, i := range imported {
+		dep := r.Find(i.Name)
+		if dep == nil {
+			dep = NewRepo(i.Name, i.Version, r, "")
+			dep.setParent(r)
+			r.AddDep(dep)
+		}
+		dep.Lock()
+		if len(i.Version.String()) > 0 {
+			dep.Version = i.Version
+		}
+		if len(i.URL) > 0 {
+			dep.URL = i.URL
+		}
+		if len(i.Reference) > 0 {
+			dep.Reference = i.Reference
+			locked[i.Name] = &LockedRepo{Name: i.Name, URL: i.URL, Type: i.Type, Reference: i.Reference}
+		}
+		dep.Unlock()
+		Log(strings.TrimSpace(fmt.Sprintf("OK %s %s %s", orDash(i.Reference), i.Name, i.Version)))
+	}
+}
+
+// importURL resolves the url of an import path which an imported repo is fetched from instead of it's own
+func importURL(name string) string {
+	// The name is resolved as a vendored repo, not as the project itself
+	o := &Repo{Name: name, Version: NoVersion(), parent: &Repo{}}
+	return o.originURL()
+}
+
+// readOptional reads the file, returning nil without an error when it doesn't exist
+func readOptional(path string) ([]byte, error) {
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	return data, err
+}
+
+// readDep reads the constraints and overrides from Gopkg.toml and the locked projects from Gopkg.lock
+func readDep(dir string) (*importedRepos, error) {
+	repos := newImportedRepos()
+	for _, file := range []string{"Gopkg.toml", "Gopkg.lock"} {
+		data, err := readOptional(filepath.Join(dir, file))
+		if err != nil {
+			return nil, err
+		}
+		if data == nil {
+			continue
+		}
+		doc, err := toml.Decode(data)
+		if err != nil {
+			return nil, fmt.Errorf("Unable to read %s: %s", file, err.Error())
+		}
+		// Overrides follow the constraints so they take precedence
+		for _, t := range append(doc.Arrays["constraint"], doc.Arrays["override"]...) {
+			i := repos.add(t.String("name"))
+			if s := t.String("source"); len(s) > 0 {
+				i.URL = s
+			}
+			switch {
+			case len(t.String("revision")) > 0:
+				i.Version = Version{Kind: VersionTypeRef, Ref: t.String("revision")}
+			case len(t.String("branch")) > 0:
+				i.Version = Version{Kind: VersionTypeBranch, Ref: t.String("branch")}
+			case len(t.String("version")) > 0:
+				i.Version = depVersion(t.String("version"))
+			}
+		}
+		for _, t := range doc.Arrays["projects"] {
+			i := repos.add(t.String("name"))
+			if s := t.String("source"); len(s) > 0 && len(i.URL) == 0 {
+				i.URL = s
+			}
+			i.lock(t.String("revision"))
+		}
+	}
+	return repos, nil
+}
+
+// depVersion translates a dep version, in which plain versions are the minimum of a caret range and anything else
+// that isn't a constraint is a tag
+func depVersion(v string) Version {
+	if !semver.IsConstraint(v) {
+		return Version{Kind: VersionTypeTag, Ref: v}
+	}
+	if c := v[0]; c == 'v' || (c >= '0' && c <= '9') {
+		v = "^" + v
+	}
+	return VersionFromString(v)
+}
+
+// glideImport is a dependency in glide.yaml or glide.lock, which names the package and version differently
+type glideImport struct {
+	Package string `yaml:"package"`
+	Name    string `yaml:"name"`
+	Version string `yaml:"version"`
+	Repo    string `yaml:"repo"`
+	VCS     string `yaml:"vcs"`
+}
+
+// readGlide reads the imports from glide.yaml and the locked commits from glide.lock
+func readGlide(dir string) (*importedRepos, error) {
+	repos := newImportedRepos()
+	for _, file := range []string{"glide.yaml", "glide.lock"} {
+		data, err := readOptional(filepath.Join(dir, file))
+		if err != nil {
+			return nil, err
+		}
+		if data == nil {
+			continue
+		}
+		glide := struct {
+			Import      []glideImport `yaml:"import"`
+			TestImport  []glideImport `yaml:"testImport"`
+			Imports     []glideImport `yaml:"imports"`
+			TestImports []glideImport `yaml:"testImports"`
+		}{}
+		err = yaml.Unmarshal(data, &glide)
+		if err != nil {
+			return nil, fmt.Errorf("Unable to read %s: %s", file, err.Error())
+		}
+		for _, g := range append(glide.Import, glide.TestImport...) {
+			i := repos.add(g.Package)
+			i.Version = VersionFromString(g.Version)
+			i.URL = g.Repo
+			i.Type = vcsTypes[g.VCS]
+		}
+		for _, g := range append(glide.Imports, glide.TestImports...) {
+			i := repos.add(g.Name)
+			if len(i.URL) == 0 {
+				i.URL = g.Repo
+				i.Type = vcsTypes[g.VCS]
+			}
+			i.lock(g.Version)
+		}
+	}
+	return repos, nil
+}
+
+// readGodep reads the packages from Godeps/Godeps.json. Packages are pinned to a revision and keep the tag they were
+// saved from as comment.
+func readGodep(dir string) (*importedRepos, error) {
+	data, err := ioutil.ReadFile(filepath.Join(dir, "Godeps", "Godeps.json"))
+	if err != nil {
+		return nil, err
+	}
+	godeps := struct {
+		Deps []struct {
+			ImportPath string
+			Comment    string
+			Rev        string
+		}
+	}{}
+	err = json.Unmarshal(data, &godeps)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read Godeps.json: %s", err.Error())
+	}
+	repos := newImportedRepos()
+	for _, d := range godeps.Deps {
+		i := repos.add(repoRoots.Root(d.ImportPath))
+		if len(d.Comment) > 0 && !regexDescribe.MatchString(d.Comment) {
+			i.Version = Version{Kind: VersionTypeTag, Ref: d.Comment}
+		}
+		i.lock(d.Rev)
+	}
+	return repos, nil
+}
+
+// readGovendor reads the packages from vendor/vendor.json. Packages copied from a different location name it as
+// origin, which is used as url unless it refers to the vendor directory of another repo.
+func readGovendor(dir string) (*importedRepos, error) {
+	data, err := ioutil.ReadFile(filepath.Join(dir, "vendor", "vendor.json"))
+	if err != nil {
+		return nil, err
+	}
+	govendor := struct {
+		Package []struct {
+			Path     string `json:"path"`
+			Origin   string `json:"origin"`
+			Revision string `json:"revision"`
+			Version  string `json:"version"`
+		} `json:"package"`
+	}{}
+	err = json.Unmarshal(data, &govendor)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read vendor.json: %s", err.Error())
+	}
+	repos := newImportedRepos()
+	for _, p := range govendor.Package {
+		i := repos.add(repoRoots.Root(p.Path))
+		if len(p.Version) > 0 {
+			i.Version = VersionFromString(p.Version)
+		}
+		if len(p.Origin) > 0 && !strings.Contains(p.Origin, "/vendor/") {
+			if origin := repoRoots.Root(p.Origin); origin != i.Name {
+				i.URL = importURL(origin)
+			}
+		}
+		i.lock(p.Revision)
+	}
+	return repos, nil
+}
+
+// readGomod reads the required modules from go.mod, including indirect ones. Release versions become the minimum of a
+// caret range and pseudo-versions are locked to their commit. go.sum is only used to verify each required version is
+// listed, modules which only appear in go.sum aren't required by the build and are left out.
+func readGomod(dir string) (*importedRepos, error) {
+	data, err := ioutil.ReadFile(filepath.Join(dir, "go.mod"))
+	if err != nil {
+		return nil, err
+	}
+	f, err := gomod.Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read go.mod: %s", err.Error())
+	}
+	replaced := map[string]gomod.Replace{}
+	for _, rp := range f.Replace {
+		replaced[rp.Old] = rp
+	}
+	repos := newImportedRepos()
+	add := func(path, version string) {
+		name := repoRoots.Root(path)
+		if name != path && len(gomod.PathMajor(path)) > 0 {
+			Logf("WARN Module %s is a major version of %s which can only be imported in module mode", path, name)
+		}
+		i := repos.add(name)
+		if rp, ok := replaced[path]; ok {
+			if isLocalPath(rp.New) {
+				Logf("WARN Replacement of %s by directory %s is ignored", path, rp.New)
+			} else {
+				i.URL = importURL(repoRoots.Root(rp.New))
+				if len(rp.NewVersion) > 0 {
+					version = rp.NewVersion
+				}
+			}
+		}
+		version = strings.TrimSuffix(version, "+incompatible")
+		if rev, ok := gomod.PseudoRevision(version); ok {
+			i.lock(rev)
+			return
+		}
+		if len(i.Version.String()) == 0 {
+			i.Version = VersionFromString("^" + version)
+		}
+		i.lock(version)
+	}
+	for _, req := range f.Require {
+		add(req.Path, req.Version)
+	}
+	data, err = readOptional(filepath.Join(dir, "go.sum"))
+	if err != nil || len(data) == 0 {
+		return repos, err
+	}
+	sums, err := gomod.ParseSum(data)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read go.sum: %s", err.Error())
+	}
+	summed := map[string]bool{}
+	for _, l := range sums {
+		summed[l.Path+"@"+l.Version] = true
+	}
+	for _, req := range f.Require {
+		// go.sum lists the replacement of a module instead, directories aren't listed at all
+		path, version := req.Path, req.Version
+		if rp, ok := replaced[req.Path]; ok {
+			if isLocalPath(rp.New) {
+				continue
+			}
+			path = rp.New
+			if len(rp.NewVersion) > 0 {
+				version = rp.NewVersion
+			}
+		}
+		if !summed[path+"@"+version] {
+			Logf("WARN Module %s %s is not listed in go.sum", path, version)
+		}
+	}
+	return repos, nil
+}
+
+// isLocalPath checks whether the path of a go.mod replacement is a directory rather than a module path
+func isLocalPath(path string) bool {
+	return filepath.IsAbs(path) || path == "." || path == ".." ||
+		strings.HasPrefix(path, "./") || strings.HasPrefix(path, "../")
+}
@@ -1,61 +1,130 @@
 package main
 
 import (
-    "sync"
+	"fmt"
+	"sync"
+
+	"github.com/codegangsta/cli"
 )
 
 // JobQueue is our internal job queue
 var JobQueue = queue{
-    list: make(chan Doer, 100),
-    wg: &sync.WaitGroup{},
+	list: make(chan Doer, 100),
+	wg:   &sync.WaitGroup{},
+	stop: make(chan bool),
 }
 
 // Doer interface describes an object that can be considered a unit of work
 type Doer interface {
-    Do() error
+	Do() error
 }
 
 // PkgInstallJob handles the installation of a package
 type PkgInstallJob struct {
-    pkg *Pkg
+	pkg *Pkg
+}
+
+// Do installs the repo of the package
+func (j *PkgInstallJob) Do() error {
+	return j.pkg.Repo.Install()
 }
 
 // PkgDiscoverJob handles the discovery of dependencies for a package
 type PkgDiscoverJob struct {
-    pkg *Pkg
+	pkg *Pkg
+}
+
+// RepoInstallJob handles the installation of a repo, optionally updating it to the newest compatible reference
+type RepoInstallJob struct {
+	repo   *Repo
+	update bool
+}
+
+// Do installs or updates the repo
+func (j *RepoInstallJob) Do() error {
+	if j.update {
+		return j.repo.Update()
+	}
+	return j.repo.Install()
+}
+
+// RepoConstrainJob checks a repo installed for another dependent against the version required by the repo's instance
+type RepoConstrainJob struct {
+	repo *Repo
+}
+
+// Do resolves the repo again when it's checkout isn't compatible with all dependents
+func (j *RepoConstrainJob) Do() error {
+	return j.repo.constrain()
 }
 
 // Queue is our internal Doer list manager
 type queue struct {
-    list chan Doer
-    wg *sync.WaitGroup
-    stop chan bool
+	sync.Mutex
+	list chan Doer
+	wg   *sync.WaitGroup
+	stop chan bool
+	errs []error
 }
 
+// Add a job to the queue. Jobs may add further jobs while being executed without blocking the worker.
 func (q *queue) Add(j Doer) {
-    q.list <- j
+	q.wg.Add(1)
+	go func() {
+		q.list <- j
+	}()
 }
 
-func (q *queue) Start() {
-    go func() {
-        for {
-    		select {
-    		case <-q.stop:
-                Log("Stopping queue execution")
-    			return
-    		case j := <- q.list:
-    			j.Do()
-                q.wg.Done()
-    			return
-    		}
-    	}
-    }()
+// Start the given number of workers to execute the queued jobs
+func (q *queue) Start(workers int) {
+	if workers < 1 {
+		workers = 1
+	}
+	for i := 0; i < workers; i++ {
+		go q.work()
+	}
 }
 
+func (q *queue) work() {
+	for {
+		select {
+		case <-q.stop:
+			return
+		case j := <-q.list:
+			err := j.Do()
+			if err != nil {
+				q.Lock()
+				q.errs = append(q.errs, err)
+				q.Unlock()
+			}
+			q.wg.Done()
+		}
+	}
+}
+
+// Stop all workers once their current job is done
 func (q *queue) Stop() {
-    q.stop <- true
+	close(q.stop)
+}
+
+// Wait for all queued jobs to be done and return the errors collected from the workers since the last call to Wait
+func (q *queue) Wait() []error {
+	q.wg.Wait()
+	q.Lock()
+	defer q.Unlock()
+	errs := q.errs
+	q.errs = nil
+	return errs
 }
 
-func (q *queue) Wait() {
-    q.wg.Wait()
+// Finish waits for all queued jobs, logs the failed ones and returns an exit error when any of them failed
+func (q *queue) Finish() error {
+	errs := q.Wait()
+	for _, err := range errs {
+		Logf("FAIL %s", err.Error())
+	}
+	if len(errs) > 0 {
+		return cli.NewExitError(fmt.Sprintf("%d dependency installs failed", len(errs)), 1)
+	}
+	return nil
 }
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/codegangsta/cli"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFinishOffline(t *testing.T) {
+	assert := assert.New(t)
+	dir, _ := ioutil.TempDir("", "jobqueue")
+	defer os.RemoveAll(dir)
+	defer func(wd, cache string, off bool) {
+		cwd = wd
+		offline = off
+		os.Setenv("VGO_CACHE", cache)
+	}(cwd, os.Getenv("VGO_CACHE"), offline)
+	cwd = dir
+	offline = true
+	os.Setenv("VGO_CACHE", filepath.Join(dir, "cache"))
+
+	q := queue{
+		list: make(chan Doer, 1),
+		wg:   &sync.WaitGroup{},
+		stop: make(chan bool),
+	}
+	q.Start(1)
+	defer q.Stop()
+
+	root := &Repo{Name: "example.com/project"}
+	dep := &Repo{Name: "github.com/test/uncached", Version: VersionFromString("^1"), URL: filepath.Join(dir, "upstream"), parent: root}
+	root.Dependencies = []*Repo{dep}
+	q.Add(&RepoInstallJob{repo: dep})
+
+	err := q.Finish()
+	if assert.Implements((*cli.ExitCoder)(nil), err, "Expected uncached dependencies to fail offline") {
+		assert.Equal(1, err.(cli.ExitCoder).ExitCode())
+	}
+	_, statErr := os.Stat(filepath.Join(dir, "vendor", "github.com", "test", "uncached"))
+	assert.True(os.IsNotExist(statErr), "Expected nothing to be installed")
+	assert.Nil(q.Finish(), "Expected the failures to be reported once")
+}
@@ -0,0 +1,113 @@
+package checksum
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// Prefix identifies the hash algorithm of a checksum
+const Prefix = "h1:"
+
+// vcsDirs contains the names of version control metadata directories which are excluded from checksums
+var vcsDirs = map[string]bool{
+	".git": true,
+	".hg":  true,
+	".bzr": true,
+	".svn": true,
+}
+
+// IsVCSDir returns whether the given directory name holds version control metadata
+func IsVCSDir(name string) bool {
+	return vcsDirs[name]
+}
+
+// Files computes the sha256 hash of each file in dir keyed by it's slash separated path relative to dir. Version
+// control metadata is excluded and symlinks are hashed by their target.
+func Files(dir string) (map[string]string, error) {
+	files := map[string]string{}
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			if path != dir && IsVCSDir(info.Name()) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		h := sha256.New()
+		if info.Mode()&os.ModeSymlink != 0 {
+			target, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			io.WriteString(h, target)
+		} else {
+			f, err := os.Open(path)
+			if err != nil {
+				return err
+			}
+			_, err = io.Copy(h, f)
+			f.Close()
+			if err != nil {
+				return err
+			}
+		}
+		files[filepath.ToSlash(rel)] = fmt.Sprintf("%x", h.Sum(nil))
+		return nil
+	})
+	return files, err
+}
+
+// Sum combines the file hashes into a single checksum which is independent of the order of the files
+func Sum(files map[string]string) string {
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	h := sha256.New()
+	for _, name := range names {
+		fmt.Fprintf(h, "%s  %s\n", files[name], name)
+	}
+	return Prefix + base64.StdEncoding.EncodeToString(h.Sum(nil))
+}
+
+// Dir computes the checksum of the files in dir
+func Dir(dir string) (string, error) {
+	files, err := Files(dir)
+	if err != nil {
+		return "", err
+	}
+	return Sum(files), nil
+}
+
+// Diff compares the file hashes against the expected file hashes and lists the added, removed and modified files
+func Diff(expected, actual map[string]string) (added, removed, modified []string) {
+	for name, h := range actual {
+		e, ok := expected[name]
+		if !ok {
+			added = append(added, name)
+		} else if e != h {
+			modified = append(modified, name)
+		}
+	}
+	for name := range expected {
+		if _, ok := actual[name]; !ok {
+			removed = append(removed, name)
+		}
+	}
+	sort.Strings(added)
+	sort.Strings(removed)
+	sort.Strings(modified)
+	return
+}
@@ -0,0 +1,43 @@
+package checksum
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/whitecypher/vgo/lib/testutils"
+)
+
+func TestDir(t *testing.T) {
+	assert := assert.New(t)
+	a, _ := ioutil.TempDir("", "checksum")
+	defer os.RemoveAll(a)
+	b, _ := ioutil.TempDir("", "checksum")
+	defer os.RemoveAll(b)
+
+	testutils.WriteFiles(t, a, map[string]string{"main.go": "package main", "sub/lib.go": "package sub"})
+	testutils.WriteFiles(t, b, map[string]string{"sub/lib.go": "package sub", "main.go": "package main", ".git/HEAD": "ref"})
+
+	ha, err := Dir(a)
+	assert.Nil(err)
+	hb, err := Dir(b)
+	assert.Nil(err)
+	assert.Equal(ha, hb, "Expected VCS metadata to be excluded")
+	assert.Contains(ha, Prefix)
+
+	testutils.WriteFiles(t, b, map[string]string{"main.go": "package main // changed"})
+	hb, _ = Dir(b)
+	assert.NotEqual(ha, hb)
+}
+
+func TestDiff(t *testing.T) {
+	added, removed, modified := Diff(
+		map[string]string{"a.go": "1", "b.go": "2", "c.go": "3"},
+		map[string]string{"a.go": "1", "b.go": "x", "d.go": "4"},
+	)
+	assert.Equal(t, []string{"d.go"}, added)
+	assert.Equal(t, []string{"c.go"}, removed)
+	assert.Equal(t, []string{"b.go"}, modified)
+}
@@ -0,0 +1,193 @@
+package goimport
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Import describes a <meta name="go-import" content="prefix vcs repo"> declaration
+type Import struct {
+	Prefix   string
+	VCS      string
+	RepoRoot string
+	Source   *Source
+}
+
+// Source describes a <meta name="go-source" content="prefix home directory file"> declaration
+type Source struct {
+	Prefix    string
+	Home      string
+	Directory string
+	File      string
+}
+
+// Default resolver used to discover import paths
+var Default = NewResolver()
+
+// Resolver discovers the repositories of import paths by fetching "https://{import path}?go-get=1" the way the go
+// command does. Results are cached by their import prefix so packages of the same repository are only fetched once.
+type Resolver struct {
+	sync.Mutex
+	Client *http.Client
+	Scheme string
+	// Offline prevents fetching, only previously resolved imports are returned
+	Offline bool
+	cache   map[string]*Import
+}
+
+// NewResolver creates a Resolver fetching over https
+func NewResolver() *Resolver {
+	return &Resolver{
+		Client: &http.Client{Timeout: 30 * time.Second},
+		Scheme: "https",
+		cache:  make(map[string]*Import),
+	}
+}
+
+// Resolve finds the go-import declaration matching the import path
+func (r *Resolver) Resolve(importPath string) (*Import, error) {
+	if i := r.cached(importPath); i != nil {
+		return i, nil
+	}
+	if r.Offline {
+		return nil, fmt.Errorf("Unable to discover %s in offline mode", importPath)
+	}
+	imports, err := r.fetch(importPath)
+	if err != nil {
+		return nil, err
+	}
+	i := match(importPath, imports)
+	if i == nil {
+		return nil, fmt.Errorf("No go-import meta tag found for %s", importPath)
+	}
+	// Verify the prefix declares the same repository to prevent one path from claiming another
+	if i.Prefix != importPath {
+		root, err := r.fetch(i.Prefix)
+		if err != nil {
+			return nil, err
+		}
+		ri := match(i.Prefix, root)
+		if ri == nil || ri.Prefix != i.Prefix || ri.VCS != i.VCS || ri.RepoRoot != i.RepoRoot {
+			return nil, fmt.Errorf("Import prefix %s of %s does not declare the same repository", i.Prefix, importPath)
+		}
+	}
+	r.Lock()
+	r.cache[i.Prefix] = i
+	r.Unlock()
+	return i, nil
+}
+
+// cached returns the previously resolved import with the longest prefix of the import path, as repositories may be
+// nested within each other
+func (r *Resolver) cached(importPath string) (m *Import) {
+	r.Lock()
+	defer r.Unlock()
+	for prefix, i := range r.cache {
+		if hasPathPrefix(importPath, prefix) && (m == nil || len(prefix) > len(m.Prefix)) {
+			m = i
+		}
+	}
+	return
+}
+
+func (r *Resolver) fetch(importPath string) ([]*Import, error) {
+	url := fmt.Sprintf("%s://%s?go-get=1", r.Scheme, importPath)
+	resp, err := r.Client.Get(url)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to fetch %s with error %s", url, err.Error())
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Unable to fetch %s with status %s", url, resp.Status)
+	}
+	return Parse(resp.Body)
+}
+
+// match selects the import with the longest prefix of the import path
+func match(importPath string, imports []*Import) (m *Import) {
+	for _, i := range imports {
+		if !hasPathPrefix(importPath, i.Prefix) || i.VCS == "mod" {
+			continue
+		}
+		if m == nil || len(i.Prefix) > len(m.Prefix) {
+			m = i
+		}
+	}
+	return
+}
+
+// hasPathPrefix checks whether the import path equals or is contained in prefix
+func hasPathPrefix(importPath, prefix string) bool {
+	return importPath == prefix || strings.HasPrefix(importPath, prefix+"/")
+}
+
+// Parse reads the go-import and go-source meta tags from the head of a html document. Sources are attached to the
+// import with the same prefix.
+func Parse(r io.Reader) (imports []*Import, err error) {
+	d := xml.NewDecoder(r)
+	d.CharsetReader = func(charset string, input io.Reader) (io.Reader, error) {
+		switch strings.ToLower(charset) {
+		case "utf-8", "ascii":
+			return input, nil
+		}
+		return nil, fmt.Errorf("Unsupported charset %s", charset)
+	}
+	d.Strict = false
+	d.AutoClose = xml.HTMLAutoClose
+	d.Entity = xml.HTMLEntity
+	sources := []*Source{}
+	for {
+		var t xml.Token
+		t, err = d.RawToken()
+		if err != nil {
+			if err == io.EOF || len(imports) > 0 {
+				err = nil
+			}
+			break
+		}
+		if e, ok := t.(xml.StartElement); ok && strings.EqualFold(e.Name.Local, "body") {
+			break
+		}
+		if e, ok := t.(xml.EndElement); ok && strings.EqualFold(e.Name.Local, "head") {
+			break
+		}
+		e, ok := t.(xml.StartElement)
+		if !ok || !strings.EqualFold(e.Name.Local, "meta") {
+			continue
+		}
+		f := strings.Fields(attr(e, "content"))
+		switch attr(e, "name") {
+		case "go-import":
+			if len(f) == 3 {
+				imports = append(imports, &Import{Prefix: f[0], VCS: f[1], RepoRoot: f[2]})
+			}
+		case "go-source":
+			if len(f) == 4 {
+				sources = append(sources, &Source{Prefix: f[0], Home: f[1], Directory: f[2], File: f[3]})
+			}
+		}
+	}
+	for _, s := range sources {
+		for _, i := range imports {
+			if i.Prefix == s.Prefix {
+				i.Source = s
+			}
+		}
+	}
+	return
+}
+
+// attr returns the value of the named attribute of the element
+func attr(e xml.StartElement, name string) string {
+	for _, a := range e.Attr {
+		if strings.EqualFold(a.Name.Local, name) {
+			return a.Value
+		}
+	}
+	return ""
+}
@@ -0,0 +1,159 @@
+package goimport
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const page = `<!DOCTYPE html>
+<html>
+<head>
+<meta http-equiv="Content-Type" content="text/html; charset=utf-8">
+<meta name="go-import" content="%[1]s/lib git https://git.example.com/lib.git">
+<meta name="go-source" content="%[1]s/lib https://git.example.com/lib https://git.example.com/lib/tree{/dir} https://git.example.com/lib/blob{/dir}/{file}#L{line}">
+<meta name="go-import" content="%[1]s/tools hg https://hg.example.com/tools">
+</head>
+<body>
+<meta name="go-import" content="%[1]s/ignored git https://git.example.com/ignored.git">
+</body>
+</html>`
+
+func newServer(requests *int32) (*httptest.Server, *Resolver) {
+	var host string
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		atomic.AddInt32(requests, 1)
+		if req.URL.Query().Get("go-get") != "1" {
+			http.NotFound(w, req)
+			return
+		}
+		switch {
+		case strings.HasPrefix(req.URL.Path, "/moved"):
+			http.Redirect(w, req, "/redirected?go-get=1", http.StatusFound)
+		case req.URL.Path == "/redirected":
+			fmt.Fprintf(w, `<meta name="go-import" content="%s/moved git https://git.example.com/moved.git">`, host)
+		case strings.HasPrefix(req.URL.Path, "/lib"), strings.HasPrefix(req.URL.Path, "/tools"):
+			fmt.Fprintf(w, page, host)
+		default:
+			http.NotFound(w, req)
+		}
+	}))
+	host = strings.TrimPrefix(srv.URL, "https://")
+	r := NewResolver()
+	r.Client = srv.Client()
+	return srv, r
+}
+
+func TestParse(t *testing.T) {
+	assert := assert.New(t)
+	imports, err := Parse(strings.NewReader(fmt.Sprintf(page, "example.com")))
+	assert.Nil(err)
+	if assert.Len(imports, 2) {
+		assert.Equal("example.com/lib", imports[0].Prefix)
+		assert.Equal("git", imports[0].VCS)
+		assert.Equal("https://git.example.com/lib.git", imports[0].RepoRoot)
+		if assert.NotNil(imports[0].Source) {
+			assert.Equal("https://git.example.com/lib", imports[0].Source.Home)
+		}
+		assert.Equal("hg", imports[1].VCS)
+		assert.Nil(imports[1].Source)
+	}
+}
+
+func TestResolve(t *testing.T) {
+	assert := assert.New(t)
+	var requests int32
+	srv, r := newServer(&requests)
+	defer srv.Close()
+	host := strings.TrimPrefix(srv.URL, "https://")
+
+	i, err := r.Resolve(host + "/lib/sub/pkg")
+	assert.Nil(err)
+	if assert.NotNil(i) {
+		assert.Equal(host+"/lib", i.Prefix)
+		assert.Equal("https://git.example.com/lib.git", i.RepoRoot)
+	}
+	// The sub package and the prefix root for verification
+	assert.Equal(int32(2), atomic.LoadInt32(&requests))
+
+	i, err = r.Resolve(host + "/lib/other")
+	assert.Nil(err)
+	assert.Equal(host+"/lib", i.Prefix)
+	assert.Equal(int32(2), atomic.LoadInt32(&requests), "Expected the prefix to be cached")
+
+	i, err = r.Resolve(host + "/tools")
+	assert.Nil(err)
+	assert.Equal("hg", i.VCS)
+}
+
+func TestResolveRedirect(t *testing.T) {
+	var requests int32
+	srv, r := newServer(&requests)
+	defer srv.Close()
+	host := strings.TrimPrefix(srv.URL, "https://")
+
+	i, err := r.Resolve(host + "/moved/pkg")
+	assert.Nil(t, err)
+	if assert.NotNil(t, i) {
+		assert.Equal(t, host+"/moved", i.Prefix)
+		assert.Equal(t, "https://git.example.com/moved.git", i.RepoRoot)
+	}
+}
+
+func TestResolveNotFound(t *testing.T) {
+	var requests int32
+	srv, r := newServer(&requests)
+	defer srv.Close()
+	host := strings.TrimPrefix(srv.URL, "https://")
+
+	_, err := r.Resolve(host + "/unknown")
+	assert.NotNil(t, err)
+}
+
+func TestResolveOffline(t *testing.T) {
+	var requests int32
+	srv, r := newServer(&requests)
+	defer srv.Close()
+	host := strings.TrimPrefix(srv.URL, "https://")
+
+	_, err := r.Resolve(host + "/lib")
+	assert.Nil(t, err)
+	r.Offline = true
+	i, err := r.Resolve(host + "/lib/pkg")
+	assert.Nil(t, err, "Expected cached imports to resolve")
+	assert.Equal(t, host+"/lib", i.Prefix)
+	_, err = r.Resolve(host + "/tools")
+	assert.NotNil(t, err)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&requests))
+}
+
+func TestResolveNestedCached(t *testing.T) {
+	r := NewResolver()
+	r.Offline = true
+	for _, prefix := range []string{"example.com/a", "example.com/a/b", "example.com/a/b/c/d"} {
+		r.cache[prefix] = &Import{Prefix: prefix, VCS: "git", RepoRoot: "https://" + prefix + ".git"}
+	}
+	cases := map[string]string{
+		"example.com/a":           "example.com/a",
+		"example.com/a/x":         "example.com/a",
+		"example.com/a/b":         "example.com/a/b",
+		"example.com/a/b/c":       "example.com/a/b",
+		"example.com/a/b/c/d/pkg": "example.com/a/b/c/d",
+	}
+	// Repeated as the cache is iterated in random order
+	for n := 0; n < 20; n++ {
+		for importPath, prefix := range cases {
+			i, err := r.Resolve(importPath)
+			if assert.Nil(t, err) {
+				assert.Equal(t, prefix, i.Prefix, "Expected the innermost repository of %s", importPath)
+			}
+		}
+	}
+	_, err := r.Resolve("example.com/ab")
+	assert.NotNil(t, err, "Expected prefixes to match whole path elements")
+}
@@ -0,0 +1,315 @@
+package gomod
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/whitecypher/vgo/lib/checksum"
+	"github.com/whitecypher/vgo/lib/version"
+)
+
+var (
+	regexCanonical = regexp.MustCompile(`^v(0|[1-9]\d*)\.(0|[1-9]\d*)\.(0|[1-9]\d*)(-[0-9A-Za-z-]+(\.[0-9A-Za-z-]+)*)?(\+incompatible)?$`)
+	regexPseudo    = regexp.MustCompile(`^v\d+\.\d+\.\d+-(?:[0-9A-Za-z.-]*\.)?\d{14}-([0-9a-f]{12})(\+incompatible)?$`)
+	regexMajor     = regexp.MustCompile(`(?:/|^gopkg\.in/.*\.)(v[0-9]+)(?:-unstable)?$`)
+)
+
+// File is the content of a go.mod file relevant to dependency management
+type File struct {
+	Module  string
+	Require []Require
+	Replace []Replace
+}
+
+// Require is a required module version
+type Require struct {
+	Path     string
+	Version  string
+	Indirect bool
+}
+
+// Replace substitutes a module, or a single version of it, by another module or a local directory
+type Replace struct {
+	Old        string
+	OldVersion string
+	New        string
+	NewVersion string
+}
+
+// SumLine is a single hash of go.sum. Hashes of go.mod files have a version ending in /go.mod.
+type SumLine struct {
+	Path    string
+	Version string
+	Hash    string
+}
+
+// Parse reads the module path, requirements and replacements from a go.mod file. Other directives are ignored.
+func Parse(data []byte) (*File, error) {
+	f := &File{}
+	block := ""
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for n := 1; scanner.Scan(); n++ {
+		line := scanner.Text()
+		comment := ""
+		if i := strings.Index(line, "//"); i >= 0 {
+			line, comment = line[:i], strings.TrimSpace(line[i+2:])
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		verb := block
+		switch {
+		case len(block) > 0 && fields[0] == ")":
+			block = ""
+			continue
+		case len(block) == 0 && len(fields) == 2 && fields[1] == "(":
+			block = fields[0]
+			continue
+		case len(block) == 0:
+			verb, fields = fields[0], fields[1:]
+		}
+		for i, field := range fields {
+			if s, err := strconv.Unquote(field); err == nil {
+				fields[i] = s
+			}
+		}
+		switch verb {
+		case "module":
+			if len(fields) != 1 {
+				return nil, fmt.Errorf("line %d: Expected module path", n)
+			}
+			f.Module = fields[0]
+		case "require":
+			if len(fields) != 2 {
+				return nil, fmt.Errorf("line %d: Expected module path and version", n)
+			}
+			f.Require = append(f.Require, Require{Path: fields[0], Version: fields[1], Indirect: comment == "indirect"})
+		case "replace":
+			r, err := parseReplace(fields)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %s", n, err.Error())
+			}
+			f.Replace = append(f.Replace, r)
+		}
+	}
+	if len(block) > 0 {
+		return nil, fmt.Errorf("Unterminated %s block", block)
+	}
+	return f, scanner.Err()
+}
+
+func parseReplace(fields []string) (r Replace, err error) {
+	arrow := -1
+	for i, f := range fields {
+		if f == "=>" {
+			arrow = i
+		}
+	}
+	old, repl := fields, []string{}
+	if arrow >= 0 {
+		old, repl = fields[:arrow], fields[arrow+1:]
+	}
+	if len(old) < 1 || len(old) > 2 || len(repl) < 1 || len(repl) > 2 {
+		err = fmt.Errorf("Expected module [version] => module [version]")
+		return
+	}
+	r.Old, r.New = old[0], repl[0]
+	if len(old) == 2 {
+		r.OldVersion = old[1]
+	}
+	if len(repl) == 2 {
+		r.NewVersion = repl[1]
+	}
+	return
+}
+
+// Format writes the module path and requirements in the layout of the go command
+func (f *File) Format() []byte {
+	buf := bytes.Buffer{}
+	fmt.Fprintf(&buf, "module %s\n", f.Module)
+	reqs := make([]string, 0, len(f.Require))
+	for _, r := range f.Require {
+		req := r.Path + " " + r.Version
+		if r.Indirect {
+			req += " // indirect"
+		}
+		reqs = append(reqs, req)
+	}
+	switch len(reqs) {
+	case 0:
+	case 1:
+		fmt.Fprintf(&buf, "\nrequire %s\n", reqs[0])
+	default:
+		fmt.Fprintf(&buf, "\nrequire (\n\t%s\n)\n", strings.Join(reqs, "\n\t"))
+	}
+	return buf.Bytes()
+}
+
+// ParseSum reads the lines of a go.sum file
+func ParseSum(data []byte) ([]SumLine, error) {
+	lines := []SumLine{}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for n := 1; scanner.Scan(); n++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("line %d: Expected module path, version and hash", n)
+		}
+		lines = append(lines, SumLine{Path: fields[0], Version: fields[1], Hash: fields[2]})
+	}
+	return lines, scanner.Err()
+}
+
+// FormatSum writes the lines of a go.sum file sorted by module path and version
+func FormatSum(lines []SumLine) []byte {
+	sorted := append([]SumLine{}, lines...)
+	sort.Sort(sumLines(sorted))
+	buf := bytes.Buffer{}
+	for _, l := range sorted {
+		fmt.Fprintf(&buf, "%s %s %s\n", l.Path, l.Version, l.Hash)
+	}
+	return buf.Bytes()
+}
+
+// IsCanonical checks whether the version is a complete semantic version with a leading v as required by modules
+func IsCanonical(v string) bool {
+	return regexCanonical.MatchString(v)
+}
+
+// PseudoRevision returns the abbreviated commit of a pseudo-version
+func PseudoRevision(v string) (string, bool) {
+	m := regexPseudo.FindStringSubmatch(v)
+	if m == nil {
+		return "", false
+	}
+	return m[1], true
+}
+
+// PathMajor returns the major version suffix of a module path e.g. v2 for example.com/mod/v2 or gopkg.in/yaml.v2, or an
+// empty string for paths without one
+func PathMajor(path string) string {
+	m := regexMajor.FindStringSubmatch(path)
+	if m == nil || m[1] == "v0" || (m[1] == "v1" && !strings.HasPrefix(path, "gopkg.in/")) {
+		return ""
+	}
+	return m[1]
+}
+
+// PseudoVersion creates the version of a commit without a version tag. The base is the nearest version tag of an
+// ancestor commit, when there is none the version starts at the major version of the module path.
+func PseudoVersion(major, base string, t time.Time, rev string) string {
+	if len(rev) > 12 {
+		rev = rev[:12]
+	}
+	stamp := t.UTC().Format("20060102150405")
+	if len(base) == 0 || !IsCanonical(base) {
+		if len(major) == 0 {
+			major = "v0"
+		}
+		return fmt.Sprintf("%s.0.0-%s-%s", major, stamp, rev)
+	}
+	v, _ := version.ParseSemVer(strings.TrimSuffix(base, "+incompatible"))
+	if len(v.Pre) > 0 {
+		return fmt.Sprintf("v%d.%d.%d-%s.0.%s-%s", v.Major, v.Minor, v.Patch, v.Pre, stamp, rev)
+	}
+	return fmt.Sprintf("v%d.%d.%d-0.%s-%s", v.Major, v.Minor, v.Patch+1, stamp, rev)
+}
+
+// HashDir computes the go.sum hash of the module version from the files in dir. Like module zip files it excludes
+// version control metadata, nested modules, vendored packages and anything but regular files.
+func HashDir(dir, path, version string) (string, error) {
+	files := map[string]string{}
+	err := filepath.Walk(dir, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			if p == dir {
+				return nil
+			}
+			if checksum.IsVCSDir(info.Name()) {
+				return filepath.SkipDir
+			}
+			if _, err := os.Stat(filepath.Join(p, "go.mod")); err == nil {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if isVendoredPackage(rel) {
+			return nil
+		}
+		f, err := os.Open(p)
+		if err != nil {
+			return err
+		}
+		h := sha256.New()
+		_, err = io.Copy(h, f)
+		f.Close()
+		if err != nil {
+			return err
+		}
+		files[path+"@"+version+"/"+rel] = fmt.Sprintf("%x", h.Sum(nil))
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return checksum.Sum(files), nil
+}
+
+// HashGoMod computes the go.sum hash of the go.mod file of the module. Modules without a go.mod file are hashed with
+// the file the go command synthesizes for them.
+func HashGoMod(path string, data []byte) string {
+	if data == nil {
+		data = []byte(fmt.Sprintf("module %s\n", path))
+	}
+	// Unlike the module files the go.mod file is hashed without the module path and version as prefix
+	return checksum.Sum(map[string]string{"go.mod": fmt.Sprintf("%x", sha256.Sum256(data))})
+}
+
+// isVendoredPackage checks whether the slash separated path is a file of a package in a vendor directory, files
+// directly within a vendor directory such as vendor/modules.txt are kept
+func isVendoredPackage(rel string) bool {
+	i := 0
+	if strings.HasPrefix(rel, "vendor/") {
+		i = len("vendor/")
+	} else if j := strings.Index(rel, "/vendor/"); j >= 0 {
+		i = j + len("/vendor/")
+	} else {
+		return false
+	}
+	return strings.Contains(rel[i:], "/")
+}
+
+// sumLines sorts go.sum lines by module path and version
+type sumLines []SumLine
+
+func (s sumLines) Len() int { return len(s) }
+func (s sumLines) Less(i, j int) bool {
+	if s[i].Path != s[j].Path {
+		return s[i].Path < s[j].Path
+	}
+	return s[i].Version < s[j].Version
+}
+func (s sumLines) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
@@ -0,0 +1,162 @@
+package gomod
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/whitecypher/vgo/lib/testutils"
+)
+
+// The expected hashes and versions were produced by the go command for the same files committed to a git repo
+
+func TestHashDir(t *testing.T) {
+	assert := assert.New(t)
+	dir, _ := ioutil.TempDir("", "gomod")
+	defer os.RemoveAll(dir)
+
+	testutils.WriteFiles(t, dir, map[string]string{
+		"lib.go":                "package lib\n\nfunc X() int { return 1 }\n",
+		"sub/sub.go":            "package sub\n",
+		"vendor/foo/bar/bar.go": "package bar\n",
+		"vendor/modules.txt":    "x\n",
+		"testdata/d.txt":        "data\n",
+		".git/HEAD":             "ref: refs/heads/master\n",
+		"nested/go.mod":         "module example.com/repo.git/nested\n",
+		"nested/nested.go":      "package nested\n",
+		"sub/vendor/baz/baz.go": "package baz\n",
+	})
+	os.Symlink("lib.go", filepath.Join(dir, "link.go"))
+
+	h, err := HashDir(dir, "example.com/repo.git", "v1.2.3")
+	assert.Nil(err)
+	assert.Equal("h1:3EGopVsEUbUNCVU0SHZy9lEDOaaneXpmVmWAWYgdOn8=", h)
+
+	h, _ = HashDir(dir, "example.com/repo.git", "v1.2.4")
+	assert.NotEqual("h1:3EGopVsEUbUNCVU0SHZy9lEDOaaneXpmVmWAWYgdOn8=", h, "Expected the version to be part of the hash")
+}
+
+func TestHashGoMod(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal("h1:SIsiNr9sndUQ1xTHElaqS6B7NeLiR39aMcEU/Vt7oZk=", HashGoMod("example.com/repo.git", nil))
+	assert.Equal(HashGoMod("example.com/repo.git", nil), HashGoMod("example.com/repo.git", []byte("module example.com/repo.git\n")))
+	assert.NotEqual(HashGoMod("example.com/repo.git", nil), HashGoMod("example.com/repo.git", []byte("module example.com/repo.git\n\ngo 1.12\n")))
+}
+
+func TestPseudoVersion(t *testing.T) {
+	assert := assert.New(t)
+	ts := time.Date(2019, 3, 5, 5, 6, 7, 0, time.UTC)
+	rev := "1264a9df045614f62d3975795bcfa76c9b76f706"
+	assert.Equal("v1.2.4-0.20190305050607-1264a9df0456", PseudoVersion("", "v1.2.3", ts, rev))
+	assert.Equal("v1.2.4-0.20190305050607-1264a9df0456", PseudoVersion("", "v1.2.3", ts.In(time.FixedZone("CET", 3600)), rev))
+	assert.Equal("v0.0.0-20190305050607-1264a9df0456", PseudoVersion("", "", ts, rev))
+	assert.Equal("v2.0.0-20190305050607-1264a9df0456", PseudoVersion("v2", "", ts, rev))
+	assert.Equal("v0.0.0-20190305050607-1264a9df0456", PseudoVersion("", "1.2.3", ts, rev), "Expected non canonical tags to be ignored")
+	assert.Equal("v1.3.0-beta.1.0.20190305050607-1264a9df0456", PseudoVersion("", "v1.3.0-beta.1", ts, rev))
+}
+
+func TestPseudoRevision(t *testing.T) {
+	assert := assert.New(t)
+	for _, v := range []string{
+		"v1.2.4-0.20190305050607-1264a9df0456",
+		"v0.0.0-20190305050607-1264a9df0456",
+		"v1.3.0-beta.1.0.20190305050607-1264a9df0456",
+		"v2.0.1-0.20190305050607-1264a9df0456+incompatible",
+	} {
+		rev, ok := PseudoRevision(v)
+		assert.True(ok, v)
+		assert.Equal("1264a9df0456", rev, v)
+	}
+	_, ok := PseudoRevision("v1.2.3")
+	assert.False(ok)
+}
+
+func TestIsCanonical(t *testing.T) {
+	assert := assert.New(t)
+	for _, v := range []string{"v1.2.3", "v0.0.0", "v1.2.3-rc.1", "v2.0.0+incompatible"} {
+		assert.True(IsCanonical(v), v)
+	}
+	for _, v := range []string{"1.2.3", "v1.2", "v01.2.3", "v1.2.3+build", "master"} {
+		assert.False(IsCanonical(v), v)
+	}
+}
+
+func TestPathMajor(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal("", PathMajor("github.com/foo/bar"))
+	assert.Equal("v2", PathMajor("github.com/foo/bar/v2"))
+	assert.Equal("", PathMajor("github.com/foo/bar/v1"))
+	assert.Equal("", PathMajor("github.com/foo/v2bar"))
+	assert.Equal("v2", PathMajor("gopkg.in/yaml.v2"))
+	assert.Equal("v1", PathMajor("gopkg.in/foo/bar.v1"))
+}
+
+func TestParse(t *testing.T) {
+	assert := assert.New(t)
+	f, err := Parse([]byte(`module example.com/app // the app
+
+go 1.12
+
+require github.com/foo/bar v1.2.3
+require (
+	github.com/foo/baz v0.0.0-20190305050607-1264a9df0456 // indirect
+	"gopkg.in/yaml.v2" v2.2.2
+)
+
+exclude github.com/foo/bar v1.2.0
+
+replace (
+	github.com/foo/bar => github.com/fork/bar v1.2.4
+	github.com/foo/baz v0.1.0 => ../baz
+)
+`))
+	assert.Nil(err)
+	assert.Equal("example.com/app", f.Module)
+	assert.Equal([]Require{
+		{Path: "github.com/foo/bar", Version: "v1.2.3"},
+		{Path: "github.com/foo/baz", Version: "v0.0.0-20190305050607-1264a9df0456", Indirect: true},
+		{Path: "gopkg.in/yaml.v2", Version: "v2.2.2"},
+	}, f.Require)
+	assert.Equal([]Replace{
+		{Old: "github.com/foo/bar", New: "github.com/fork/bar", NewVersion: "v1.2.4"},
+		{Old: "github.com/foo/baz", OldVersion: "v0.1.0", New: "../baz"},
+	}, f.Replace)
+
+	_, err = Parse([]byte("module example.com/app\nrequire (\n\tgithub.com/foo/bar v1.2.3\n"))
+	assert.NotNil(err)
+	_, err = Parse([]byte("require github.com/foo/bar"))
+	assert.NotNil(err)
+}
+
+func TestFormat(t *testing.T) {
+	assert := assert.New(t)
+	f := &File{Module: "example.com/app"}
+	assert.Equal("module example.com/app\n", string(f.Format()))
+	f.Require = []Require{{Path: "github.com/foo/bar", Version: "v1.2.3"}}
+	assert.Equal("module example.com/app\n\nrequire github.com/foo/bar v1.2.3\n", string(f.Format()))
+	f.Require = append(f.Require, Require{Path: "github.com/foo/baz", Version: "v0.1.0", Indirect: true})
+	assert.Equal("module example.com/app\n\nrequire (\n\tgithub.com/foo/bar v1.2.3\n\tgithub.com/foo/baz v0.1.0 // indirect\n)\n", string(f.Format()))
+
+	parsed, err := Parse(f.Format())
+	assert.Nil(err)
+	assert.Equal(f, parsed)
+}
+
+func TestSum(t *testing.T) {
+	assert := assert.New(t)
+	data := "github.com/foo/bar v1.2.3 h1:abc=\ngithub.com/foo/bar v1.2.3/go.mod h1:def=\n"
+	lines, err := ParseSum([]byte(data))
+	assert.Nil(err)
+	assert.Equal([]SumLine{
+		{Path: "github.com/foo/bar", Version: "v1.2.3", Hash: "h1:abc="},
+		{Path: "github.com/foo/bar", Version: "v1.2.3/go.mod", Hash: "h1:def="},
+	}, lines)
+	assert.Equal(data, string(FormatSum([]SumLine{lines[1], lines[0]})))
+
+	_, err = ParseSum([]byte("github.com/foo/bar v1.2.3\n"))
+	assert.NotNil(err)
+}
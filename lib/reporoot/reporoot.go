@@ -0,0 +1,123 @@
+package reporoot
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+var (
+	// rules match the repository root of import paths on hosts with a known layout
+	rules = []*regexp.Regexp{
+		regexp.MustCompile(`^(github\.com/[A-Za-z0-9_.\-]+/[A-Za-z0-9_.\-]+)(/|$)`),
+		regexp.MustCompile(`^(bitbucket\.org/[A-Za-z0-9_.\-]+/[A-Za-z0-9_.\-]+)(/|$)`),
+		regexp.MustCompile(`^(golang\.org/x/[A-Za-z0-9_.\-]+)(/|$)`),
+		regexp.MustCompile(`^(gopkg\.in/(?:[A-Za-z0-9_\-]+/)?[A-Za-z0-9_\-.]+\.v[0-9]+(?:-unstable)?)(/|$)`),
+		regexp.MustCompile(`^((?:[a-z0-9.\-]+\.)+[a-z0-9.\-]+(?::[0-9]+)?(?:/~?[A-Za-z0-9_.\-]+)+?\.(?:bzr|git|hg|svn))(/|$)`),
+	}
+	vcsDirs = []string{".git", ".hg", ".bzr", ".svn"}
+)
+
+// Resolver maps import paths to the import path of their repository root
+type Resolver struct {
+	sync.Mutex
+	// Dirs are searched for existing checkouts e.g. the vendor directory and $GOPATH/src
+	Dirs []string
+	// Discover resolves the import prefix declared by the go-import meta tag of an import path
+	Discover func(importPath string) (string, error)
+	cache    map[string]string
+}
+
+// NewResolver creates a Resolver searching the given dirs for existing checkouts
+func NewResolver(discover func(string) (string, error), dirs ...string) *Resolver {
+	return &Resolver{
+		Dirs:     dirs,
+		Discover: discover,
+		cache:    make(map[string]string),
+	}
+}
+
+// Add registers a known repository root e.g. that of the project itself
+func (r *Resolver) Add(root string) {
+	r.Lock()
+	r.cache[root] = root
+	r.Unlock()
+}
+
+// Root resolves the repository root of the import path using the known host rules, existing checkouts on disk and
+// go-import meta tags in that order. When none of them apply the first three path segments are assumed to be the root.
+func (r *Resolver) Root(importPath string) string {
+	r.Lock()
+	for root := range r.cache {
+		if hasPathPrefix(importPath, root) {
+			r.Unlock()
+			return root
+		}
+	}
+	r.Unlock()
+	root, ok := Known(importPath)
+	if !ok {
+		root, ok = r.onDisk(importPath)
+	}
+	if !ok && r.Discover != nil {
+		prefix, err := r.Discover(importPath)
+		ok = err == nil && hasPathPrefix(importPath, prefix)
+		root = prefix
+	}
+	if !ok {
+		// Cached as well to prevent repeated discovery of unreachable hosts
+		root = Heuristic(importPath)
+	}
+	r.Add(root)
+	return root
+}
+
+// onDisk finds the shortest prefix of the import path which is a checkout in one of the dirs
+func (r *Resolver) onDisk(importPath string) (string, bool) {
+	parts := strings.Split(importPath, "/")
+	for i := 1; i <= len(parts); i++ {
+		prefix := strings.Join(parts[:i], "/")
+		for _, dir := range r.Dirs {
+			if isCheckout(filepath.Join(dir, filepath.FromSlash(prefix))) {
+				return prefix, true
+			}
+		}
+	}
+	return "", false
+}
+
+// isCheckout checks whether the dir contains version control metadata
+func isCheckout(dir string) bool {
+	for _, d := range vcsDirs {
+		if _, err := os.Stat(filepath.Join(dir, d)); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// Known resolves the repository root of import paths on hosts with a known layout
+func Known(importPath string) (string, bool) {
+	for _, rule := range rules {
+		if m := rule.FindStringSubmatch(importPath); m != nil {
+			return m[1], true
+		}
+	}
+	return "", false
+}
+
+// Heuristic limits the import path to it's first three segments
+func Heuristic(importPath string) string {
+	parts := strings.Split(importPath, "/")
+	if len(parts) > 3 {
+		parts = parts[0:3]
+	}
+	return strings.Join(parts, "/")
+}
+
+// hasPathPrefix checks whether the import path equals or is contained in prefix
+func hasPathPrefix(importPath, prefix string) bool {
+	return importPath == prefix || strings.HasPrefix(importPath, prefix+"/")
+}
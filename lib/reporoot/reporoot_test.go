@@ -0,0 +1,81 @@
+package reporoot
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKnown(t *testing.T) {
+	cases := map[string]string{
+		"github.com/codegangsta/cli":              "github.com/codegangsta/cli",
+		"github.com/Masterminds/vcs/sub/pkg":      "github.com/Masterminds/vcs",
+		"golang.org/x/net/context":                "golang.org/x/net",
+		"gopkg.in/yaml.v2":                        "gopkg.in/yaml.v2",
+		"gopkg.in/yaml.v2/sub":                    "gopkg.in/yaml.v2",
+		"gopkg.in/natefinch/lumberjack.v2":        "gopkg.in/natefinch/lumberjack.v2",
+		"gopkg.in/src-d/go-git.v4/plumbing":       "gopkg.in/src-d/go-git.v4",
+		"bitbucket.org/ww/goautoneg":              "bitbucket.org/ww/goautoneg",
+		"bitbucket.org/ww/goautoneg/sub":          "bitbucket.org/ww/goautoneg",
+		"example.com/group/repo.git/sub/pkg":      "example.com/group/repo.git",
+		"git.example.com:8080/team/tools.hg/util": "git.example.com:8080/team/tools.hg",
+	}
+	for importPath, expected := range cases {
+		root, ok := Known(importPath)
+		assert.True(t, ok, "Expected %s to match a known host", importPath)
+		assert.Equal(t, expected, root)
+	}
+	for _, importPath := range []string{"gitlab.com/group/subgroup/repo", "go.uber.org/zap", "github.com/user"} {
+		_, ok := Known(importPath)
+		assert.False(t, ok, "Expected %s not to match a known host", importPath)
+	}
+}
+
+func TestRootOnDisk(t *testing.T) {
+	assert := assert.New(t)
+	dir, _ := ioutil.TempDir("", "reporoot")
+	defer os.RemoveAll(dir)
+	os.MkdirAll(filepath.Join(dir, "example.com", "team", "repo", ".git"), 0775)
+
+	r := NewResolver(nil, filepath.Join(dir, "missing"), dir)
+	assert.Equal("example.com/team/repo", r.Root("example.com/team/repo/sub/pkg"))
+	assert.Equal("example.com/team/repo", r.Root("example.com/team/repo"))
+}
+
+func TestRootDiscover(t *testing.T) {
+	assert := assert.New(t)
+	calls := 0
+	r := NewResolver(func(importPath string) (string, error) {
+		calls++
+		switch {
+		case hasPathPrefix(importPath, "gitlab.com/group/subgroup/repo"):
+			return "gitlab.com/group/subgroup/repo", nil
+		case hasPathPrefix(importPath, "go.uber.org/zap"):
+			return "go.uber.org/zap", nil
+		case hasPathPrefix(importPath, "example.com/liar"):
+			return "example.com/other", nil
+		}
+		return "", errors.New("not found")
+	})
+	assert.Equal("gitlab.com/group/subgroup/repo", r.Root("gitlab.com/group/subgroup/repo/pkg"))
+	assert.Equal("go.uber.org/zap", r.Root("go.uber.org/zap/zapcore"))
+	assert.Equal("go.uber.org/zap", r.Root("go.uber.org/zap/buffer"))
+	assert.Equal(2, calls, "Expected resolved roots to be cached")
+
+	// Unresolvable paths and prefixes not containing the import path fall back to the first three segments
+	assert.Equal("example.com/liar/repo", r.Root("example.com/liar/repo/pkg"))
+	assert.Equal("unknown.org/a/b", r.Root("unknown.org/a/b/c"))
+}
+
+func TestRootAdd(t *testing.T) {
+	r := NewResolver(func(importPath string) (string, error) {
+		t.Fatalf("Unexpected discovery of %s", importPath)
+		return "", nil
+	})
+	r.Add("example.com/project")
+	assert.Equal(t, "example.com/project", r.Root("example.com/project/internal/pkg"))
+}
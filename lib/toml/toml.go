@@ -0,0 +1,209 @@
+package toml
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Table maps keys to their values. Values are strings, booleans or arrays of values, other scalars such as numbers and
+// dates are kept as their unparsed string.
+type Table map[string]interface{}
+
+// Document is a decoded TOML document. Only the subset of TOML used by the manifest and lock files of dep is supported,
+// inline tables and dotted keys are not.
+type Document struct {
+	// Table contains the keys before the first table header
+	Table
+	// Tables contains the tables by their header e.g. [metadata]
+	Tables map[string]Table
+	// Arrays contains the arrays of tables by their header e.g. [[constraint]]
+	Arrays map[string][]Table
+}
+
+// Decode parses the document
+func Decode(data []byte) (*Document, error) {
+	doc := &Document{
+		Table:  Table{},
+		Tables: map[string]Table{},
+		Arrays: map[string][]Table{},
+	}
+	current := doc.Table
+	lines := strings.Split(string(data), "\n")
+	for i := 0; i < len(lines); i++ {
+		n := i + 1
+		line := strings.TrimSpace(stripComment(lines[i]))
+		switch {
+		case len(line) == 0:
+			continue
+		case strings.HasPrefix(line, "[["):
+			if !strings.HasSuffix(line, "]]") {
+				return nil, fmt.Errorf("line %d: Invalid table header %s", n, line)
+			}
+			name := strings.TrimSpace(line[2 : len(line)-2])
+			current = Table{}
+			doc.Arrays[name] = append(doc.Arrays[name], current)
+		case strings.HasPrefix(line, "["):
+			if !strings.HasSuffix(line, "]") {
+				return nil, fmt.Errorf("line %d: Invalid table header %s", n, line)
+			}
+			name := strings.TrimSpace(line[1 : len(line)-1])
+			if _, ok := doc.Tables[name]; !ok {
+				doc.Tables[name] = Table{}
+			}
+			current = doc.Tables[name]
+		default:
+			eq := strings.Index(line, "=")
+			if eq < 0 {
+				return nil, fmt.Errorf("line %d: Expected key = value, found %s", n, line)
+			}
+			key := strings.TrimSpace(line[:eq])
+			if k, err := strconv.Unquote(key); err == nil {
+				key = k
+			}
+			raw := strings.TrimSpace(line[eq+1:])
+			// Arrays may span multiple lines
+			for depth(raw) > 0 && i+1 < len(lines) {
+				i++
+				raw += " " + strings.TrimSpace(stripComment(lines[i]))
+			}
+			v, rest, err := parseValue(raw)
+			if err == nil && len(strings.TrimSpace(rest)) > 0 {
+				err = fmt.Errorf("Unexpected %s", rest)
+			}
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %s", n, err.Error())
+			}
+			current[key] = v
+		}
+	}
+	return doc, nil
+}
+
+// String returns the string value of the key or an empty string
+func (t Table) String(key string) string {
+	s, _ := t[key].(string)
+	return s
+}
+
+// Strings returns the string values of the array of the key
+func (t Table) Strings(key string) []string {
+	list, _ := t[key].([]interface{})
+	strs := []string{}
+	for _, v := range list {
+		if s, ok := v.(string); ok {
+			strs = append(strs, s)
+		}
+	}
+	return strs
+}
+
+// scan calls fn for each byte of s outside of strings, stopping when fn returns false
+func scan(s string, fn func(i int, c byte) bool) {
+	var quote byte
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quote == '"' && c == '\\':
+			i++
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		default:
+			if !fn(i, c) {
+				return
+			}
+		}
+	}
+}
+
+// stripComment removes a trailing comment from the line
+func stripComment(line string) string {
+	end := len(line)
+	scan(line, func(i int, c byte) bool {
+		if c == '#' {
+			end = i
+			return false
+		}
+		return true
+	})
+	return line[:end]
+}
+
+// depth counts the arrays which are left open by s
+func depth(s string) int {
+	d := 0
+	scan(s, func(i int, c byte) bool {
+		switch c {
+		case '[':
+			d++
+		case ']':
+			d--
+		}
+		return true
+	})
+	return d
+}
+
+// parseValue parses the value at the start of s and returns the remainder of s
+func parseValue(s string) (interface{}, string, error) {
+	s = strings.TrimSpace(s)
+	if len(s) == 0 {
+		return nil, s, fmt.Errorf("Missing value")
+	}
+	switch s[0] {
+	case '"':
+		for i := 1; i < len(s); i++ {
+			if s[i] == '\\' {
+				i++
+				continue
+			}
+			if s[i] == '"' {
+				v, err := strconv.Unquote(s[:i+1])
+				return v, s[i+1:], err
+			}
+		}
+		return nil, s, fmt.Errorf("Unterminated string %s", s)
+	case '\'':
+		end := strings.IndexByte(s[1:], '\'')
+		if end < 0 {
+			return nil, s, fmt.Errorf("Unterminated string %s", s)
+		}
+		return s[1 : end+1], s[end+2:], nil
+	case '[':
+		list := []interface{}{}
+		rest := s[1:]
+		for {
+			rest = strings.TrimLeft(rest, " \t\r,")
+			if len(rest) == 0 {
+				return nil, rest, fmt.Errorf("Unterminated array %s", s)
+			}
+			if rest[0] == ']' {
+				return list, rest[1:], nil
+			}
+			var v interface{}
+			var err error
+			v, rest, err = parseValue(rest)
+			if err != nil {
+				return nil, rest, err
+			}
+			list = append(list, v)
+		}
+	case '{':
+		return nil, s, fmt.Errorf("Inline tables are not supported")
+	}
+	end := strings.IndexAny(s, " \t,]")
+	if end < 0 {
+		end = len(s)
+	}
+	switch s[:end] {
+	case "true":
+		return true, s[end:], nil
+	case "false":
+		return false, s[end:], nil
+	}
+	return s[:end], s[end:], nil
+}
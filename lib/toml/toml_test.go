@@ -0,0 +1,69 @@
+package toml
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDecode(t *testing.T) {
+	assert := assert.New(t)
+	doc, err := Decode([]byte(`
+# Gopkg.toml example
+required = ["github.com/foo/cmd", 'github.com/bar/cmd']
+
+[[constraint]]
+  name = "github.com/foo/bar" # inline comment
+  version = "^1.2.0"
+
+[[constraint]]
+  name = "github.com/foo/baz"
+  branch = "master"
+  source = "https://example.com/#fork.git"
+
+[prune]
+  go-tests = true
+  unused-packages = false
+
+[metadata]
+  inputs-digest = "abc"
+  count = 3
+  names = [
+    "one", # first
+    "two",
+  ]
+`))
+	assert.Nil(err)
+	assert.Equal([]string{"github.com/foo/cmd", "github.com/bar/cmd"}, doc.Strings("required"))
+	assert.Len(doc.Arrays["constraint"], 2)
+	assert.Equal("github.com/foo/bar", doc.Arrays["constraint"][0].String("name"))
+	assert.Equal("^1.2.0", doc.Arrays["constraint"][0].String("version"))
+	assert.Equal("", doc.Arrays["constraint"][0].String("branch"))
+	assert.Equal("https://example.com/#fork.git", doc.Arrays["constraint"][1].String("source"))
+	assert.Equal(true, doc.Tables["prune"]["go-tests"])
+	assert.Equal(false, doc.Tables["prune"]["unused-packages"])
+	assert.Equal("3", doc.Tables["metadata"].String("count"))
+	assert.Equal([]string{"one", "two"}, doc.Tables["metadata"].Strings("names"))
+}
+
+func TestDecodeEscapes(t *testing.T) {
+	assert := assert.New(t)
+	doc, err := Decode([]byte(`quoted = "a \"b\" # c"`))
+	assert.Nil(err)
+	assert.Equal(`a "b" # c`, doc.String("quoted"))
+}
+
+func TestDecodeErrors(t *testing.T) {
+	assert := assert.New(t)
+	for _, data := range []string{
+		"[[constraint]\nname = \"a\"",
+		"name",
+		"name = \"a",
+		"names = [\"a\"",
+		"name = { a = 1 }",
+		"name = \"a\" \"b\"",
+	} {
+		_, err := Decode([]byte(data))
+		assert.NotNil(err, data)
+	}
+}
@@ -0,0 +1,218 @@
+package version
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	regexPartial  = regexp.MustCompile(`^[vV]?(\d+|[xX*])(?:\.(\d+|[xX*]))?(?:\.(\d+|[xX*]))?(?:-([0-9A-Za-z-]+(?:\.[0-9A-Za-z-]+)*))?(?:\+([0-9A-Za-z-]+(?:\.[0-9A-Za-z-]+)*))?$`)
+	regexOperator = regexp.MustCompile(`(>=|<=|!=|==|>|<|=|\^|~)\s+`)
+	operators     = []string{">=", "<=", "!=", "==", ">", "<", "=", "^", "~"}
+)
+
+// Constraint is a set of version ranges e.g. "^1.2", "~1.2.3", "1.x", ">=1.0 <2.0" or "1.2 || 2.x". Comparators
+// separated by spaces or commas must all match, while groups separated by "||" need only one match.
+type Constraint struct {
+	raw    string
+	groups [][]comparator
+}
+
+// comparator is a single version range. Every supported operator is expanded to an optional lower and upper bound.
+type comparator struct {
+	min     *SemVer
+	minIncl bool
+	max     *SemVer
+	maxIncl bool
+	negate  bool
+}
+
+// ParseConstraint parses a constraint string
+func ParseConstraint(s string) (*Constraint, error) {
+	c := &Constraint{raw: s}
+	for _, group := range strings.Split(s, "||") {
+		group = regexOperator.ReplaceAllString(strings.TrimSpace(group), "$1")
+		fields := strings.FieldsFunc(group, func(r rune) bool {
+			return r == ',' || r == ' ' || r == '\t'
+		})
+		if len(fields) == 0 {
+			// An empty group matches everything
+			fields = []string{"*"}
+		}
+		comparators := []comparator{}
+		for _, f := range fields {
+			cmp, err := parseComparator(f)
+			if err != nil {
+				return nil, fmt.Errorf("Invalid version constraint %s: %s", s, err.Error())
+			}
+			comparators = append(comparators, cmp)
+		}
+		c.groups = append(c.groups, comparators)
+	}
+	return c, nil
+}
+
+// IsConstraint checks whether the string can be parsed as a version constraint
+func IsConstraint(s string) bool {
+	if len(strings.TrimSpace(s)) == 0 {
+		return false
+	}
+	_, err := ParseConstraint(s)
+	return err == nil
+}
+
+func parseComparator(s string) (cmp comparator, err error) {
+	op := ""
+	for _, o := range operators {
+		if strings.HasPrefix(s, o) {
+			op = o
+			break
+		}
+	}
+	m := regexPartial.FindStringSubmatch(s[len(op):])
+	if m == nil {
+		err = fmt.Errorf("Unable to parse %s", s)
+		return
+	}
+
+	// Resolve the number of specified parts, anything from the first wildcard onwards is unspecified
+	parts := 0
+	nums := [3]uint64{}
+	for i := 0; i < 3; i++ {
+		p := m[i+1]
+		if len(p) == 0 || p == "x" || p == "X" || p == "*" {
+			break
+		}
+		nums[i], err = strconv.ParseUint(p, 10, 64)
+		if err != nil {
+			return
+		}
+		parts++
+	}
+	v := SemVer{Major: nums[0], Minor: nums[1], Patch: nums[2]}
+	if parts == 3 {
+		v.Pre = m[4]
+		v.Build = m[5]
+	}
+
+	if parts == 0 {
+		switch op {
+		case "", "=", "==", "^", "~", ">=", "<=":
+			return comparator{}, nil
+		}
+		// Nothing is greater than, lower than or unequal to everything
+		return comparator{negate: true}, nil
+	}
+
+	switch op {
+	case "", "=", "==":
+		cmp = rangeOf(v, parts)
+	case "!=":
+		cmp = rangeOf(v, parts)
+		cmp.negate = true
+	case "^":
+		cmp = comparator{min: &v, minIncl: true}
+		switch {
+		case v.Major > 0 || parts == 1:
+			cmp.max = &SemVer{Major: v.Major + 1}
+		case v.Minor > 0 || parts == 2:
+			cmp.max = &SemVer{Minor: v.Minor + 1}
+		default:
+			cmp.max = &SemVer{Patch: v.Patch + 1}
+		}
+	case "~":
+		cmp = comparator{min: &v, minIncl: true}
+		if parts == 1 {
+			cmp.max = &SemVer{Major: v.Major + 1}
+		} else {
+			cmp.max = &SemVer{Major: v.Major, Minor: v.Minor + 1}
+		}
+	case ">":
+		r := rangeOf(v, parts)
+		cmp = comparator{min: r.max, minIncl: !r.maxIncl}
+	case ">=":
+		cmp = comparator{min: &v, minIncl: true}
+	case "<":
+		cmp = comparator{max: &v}
+	case "<=":
+		r := rangeOf(v, parts)
+		cmp = comparator{max: r.max, maxIncl: r.maxIncl}
+	}
+	return
+}
+
+// rangeOf expands a (partial) version into the range of versions it stands for e.g. "1.2" is ">=1.2.0 <1.3.0"
+func rangeOf(v SemVer, parts int) comparator {
+	switch parts {
+	case 1:
+		return comparator{min: &v, minIncl: true, max: &SemVer{Major: v.Major + 1}}
+	case 2:
+		return comparator{min: &v, minIncl: true, max: &SemVer{Major: v.Major, Minor: v.Minor + 1}}
+	}
+	return comparator{min: &v, minIncl: true, max: &v, maxIncl: true}
+}
+
+func (cmp comparator) check(v SemVer) bool {
+	ok := true
+	if cmp.min != nil {
+		d := v.Compare(*cmp.min)
+		ok = d > 0 || (d == 0 && cmp.minIncl)
+	}
+	if ok && cmp.max != nil {
+		d := v.Compare(*cmp.max)
+		ok = d < 0 || (d == 0 && cmp.maxIncl)
+	}
+	return ok != cmp.negate
+}
+
+// allowsPre checks whether the comparator explicitly mentions a prerelease of the same release as the version
+func (cmp comparator) allowsPre(v SemVer) bool {
+	for _, b := range []*SemVer{cmp.min, cmp.max} {
+		if b != nil && len(b.Pre) > 0 && b.sameRelease(v) {
+			return true
+		}
+	}
+	return false
+}
+
+// Check whether the version satisfies the constraint. Prerelease versions only satisfy a constraint which mentions a
+// prerelease of the same major, minor and patch version.
+func (c *Constraint) Check(v SemVer) bool {
+	for _, group := range c.groups {
+		ok := true
+		pre := len(v.Pre) == 0
+		for _, cmp := range group {
+			if !cmp.check(v) {
+				ok = false
+				break
+			}
+			pre = pre || cmp.allowsPre(v)
+		}
+		if ok && pre {
+			return true
+		}
+	}
+	return false
+}
+
+// Best selects the highest of the given tags which satisfies the constraint. Tags which aren't semantic versions are
+// ignored.
+func (c *Constraint) Best(tags []string) (best string, ok bool) {
+	var bestVer SemVer
+	for _, tag := range tags {
+		v, err := ParseSemVer(tag)
+		if err != nil || !c.Check(v) {
+			continue
+		}
+		if !ok || v.Compare(bestVer) > 0 {
+			best, bestVer, ok = tag, v, true
+		}
+	}
+	return
+}
+
+func (c *Constraint) String() string {
+	return c.raw
+}
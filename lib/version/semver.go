@@ -0,0 +1,120 @@
+package version
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	regexSemVer = regexp.MustCompile(`^[vV]?(\d+)(?:\.(\d+))?(?:\.(\d+))?(?:-([0-9A-Za-z-]+(?:\.[0-9A-Za-z-]+)*))?(?:\+([0-9A-Za-z-]+(?:\.[0-9A-Za-z-]+)*))?$`)
+)
+
+// SemVer is a parsed semantic version e.g. "v1.2.3-beta.1+build.5"
+type SemVer struct {
+	Major uint64
+	Minor uint64
+	Patch uint64
+	Pre   string
+	Build string
+}
+
+// ParseSemVer parses a semantic version. A leading "v" is allowed and missing minor and patch numbers default to 0
+// so that tags like "v1.4" can be compared.
+func ParseSemVer(s string) (v SemVer, err error) {
+	m := regexSemVer.FindStringSubmatch(strings.TrimSpace(s))
+	if m == nil {
+		err = fmt.Errorf("Invalid semantic version %s", s)
+		return
+	}
+	nums := []*uint64{&v.Major, &v.Minor, &v.Patch}
+	for i, n := range nums {
+		if len(m[i+1]) == 0 {
+			continue
+		}
+		*n, err = strconv.ParseUint(m[i+1], 10, 64)
+		if err != nil {
+			return
+		}
+	}
+	v.Pre = m[4]
+	v.Build = m[5]
+	return
+}
+
+// Compare returns -1, 0 or 1 when the version is respectively lower than, equal to or greater than the given version.
+// Build metadata is ignored as prescribed by the SemVer specification.
+func (v SemVer) Compare(o SemVer) int {
+	if d := compareUint(v.Major, o.Major); d != 0 {
+		return d
+	}
+	if d := compareUint(v.Minor, o.Minor); d != 0 {
+		return d
+	}
+	if d := compareUint(v.Patch, o.Patch); d != 0 {
+		return d
+	}
+	return comparePre(v.Pre, o.Pre)
+}
+
+// sameRelease checks whether both versions share the same major, minor and patch numbers
+func (v SemVer) sameRelease(o SemVer) bool {
+	return v.Major == o.Major && v.Minor == o.Minor && v.Patch == o.Patch
+}
+
+func (v SemVer) String() string {
+	s := fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+	if len(v.Pre) > 0 {
+		s += "-" + v.Pre
+	}
+	if len(v.Build) > 0 {
+		s += "+" + v.Build
+	}
+	return s
+}
+
+func compareUint(a, b uint64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// comparePre compares prerelease identifiers. A version without prerelease has a higher precedence, numeric
+// identifiers are compared numerically and have a lower precedence than alphanumeric identifiers.
+func comparePre(a, b string) int {
+	if a == b {
+		return 0
+	}
+	if len(a) == 0 {
+		return 1
+	}
+	if len(b) == 0 {
+		return -1
+	}
+	ap := strings.Split(a, ".")
+	bp := strings.Split(b, ".")
+	for i := 0; i < len(ap) && i < len(bp); i++ {
+		an, aerr := strconv.ParseUint(ap[i], 10, 64)
+		bn, berr := strconv.ParseUint(bp[i], 10, 64)
+		switch {
+		case aerr == nil && berr == nil:
+			if d := compareUint(an, bn); d != 0 {
+				return d
+			}
+		case aerr == nil:
+			return -1
+		case berr == nil:
+			return 1
+		default:
+			if d := strings.Compare(ap[i], bp[i]); d != 0 {
+				return d
+			}
+		}
+	}
+	return compareUint(uint64(len(ap)), uint64(len(bp)))
+}
@@ -1,7 +1,7 @@
 package version
 
 import (
-    "regexp"
+	"regexp"
 )
 
 // Type enum type
@@ -16,13 +16,12 @@ const (
 )
 
 var (
-    noVersion = Version{
-    	Kind: TypeNone,
-    }
-    regexSemver = regexp.MustCompile("^v?[.0-9]+(!?-[.0-9A-Za-z]+)(!?\\+[.0-9A-Za-z]+)$")
+	noVersion = Version{
+		Kind: TypeNone,
+	}
+	regexRef = regexp.MustCompile("^[0-9a-fA-F]{7,40}$")
 )
 
-
 // NoVersion returns a Version of TypeNone
 func NoVersion() Version {
 	return noVersion
@@ -30,32 +29,50 @@ func NoVersion() Version {
 
 // FromString creates a Version instance from a string
 func FromString(v string) Version {
-    k := resolveKindFromString(v)
+	k := resolveKindFromString(v)
 	return Version{
 		Kind: k,
-		Ref: v,
+		Ref:  v,
 	}
 }
 
+// resolveKindFromString resolves commit hashes as TypeRef, version constraints as TypeSemVer and anything else (e.g.
+// branch names) as TypeNamed. Hashes consisting of digits only are considered to be versions.
 func resolveKindFromString(v string) Type {
-    if len(v) == 0 {
-        return TypeNone
-    }
-    if regexSemver.
-
-    return
+	if len(v) == 0 {
+		return TypeNone
+	}
+	if regexRef.MatchString(v) && !regexSemVer.MatchString(v) {
+		return TypeRef
+	}
+	if IsConstraint(v) {
+		return TypeSemVer
+	}
+	return TypeNamed
 }
 
 // Version compatibility string e.g. "1.0.0" or "1"
 type Version struct {
 	Kind Type
-	Ref string
+	Ref  string
 }
 
-// IsCompatibleWith checks if given version is compatible
+// IsCompatibleWith checks if given version is compatible. Semantic versions are checked against the constraint while
+// other kinds of versions need to match exactly.
 func (v Version) IsCompatibleWith(t Version) bool {
+	if v.Kind == TypeSemVer {
+		c, err := ParseConstraint(v.Ref)
+		if err != nil {
+			return false
+		}
+		sv, err := ParseSemVer(t.Ref)
+		if err != nil {
+			return false
+		}
+		return c.Check(sv)
+	}
 	if v.Kind == t.Kind && v.Ref == t.Ref {
-        return true
+		return true
 	}
 
 	return false
@@ -64,7 +81,3 @@ func (v Version) IsCompatibleWith(t Version) bool {
 func (v Version) String() string {
 	return v.Ref
 }
-
-// Marshal YAML
-
-// UnmarshalYAML
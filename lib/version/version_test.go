@@ -0,0 +1,158 @@
+package version
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseSemVer(t *testing.T) {
+	assert := assert.New(t)
+
+	v, err := ParseSemVer("v1.2.3-beta.1+build.5")
+	assert.Nil(err)
+	assert.Equal(SemVer{Major: 1, Minor: 2, Patch: 3, Pre: "beta.1", Build: "build.5"}, v)
+
+	v, err = ParseSemVer("1.4")
+	assert.Nil(err)
+	assert.Equal(SemVer{Major: 1, Minor: 4}, v)
+
+	_, err = ParseSemVer("master")
+	assert.NotNil(err)
+}
+
+func TestSemVerCompare(t *testing.T) {
+	ordered := []string{
+		"1.0.0-alpha",
+		"1.0.0-alpha.1",
+		"1.0.0-alpha.beta",
+		"1.0.0-beta",
+		"1.0.0-beta.2",
+		"1.0.0-beta.11",
+		"1.0.0-rc.1",
+		"1.0.0",
+		"1.0.1",
+		"1.2.0",
+		"1.10.0",
+		"2.0.0",
+	}
+	for i := 1; i < len(ordered); i++ {
+		a, _ := ParseSemVer(ordered[i-1])
+		b, _ := ParseSemVer(ordered[i])
+		assert.Equal(t, -1, a.Compare(b), "Expected %s < %s", ordered[i-1], ordered[i])
+		assert.Equal(t, 1, b.Compare(a), "Expected %s > %s", ordered[i], ordered[i-1])
+	}
+	a, _ := ParseSemVer("v1.0.0+build.1")
+	b, _ := ParseSemVer("1.0.0+build.2")
+	assert.Equal(t, 0, a.Compare(b), "Expected build metadata to be ignored")
+}
+
+func TestConstraintCheck(t *testing.T) {
+	cases := []struct {
+		constraint string
+		version    string
+		expected   bool
+	}{
+		{"1.2.3", "1.2.3", true},
+		{"1.2.3", "v1.2.3", true},
+		{"v1.2.3", "1.2.4", false},
+		{"=1.2.3", "1.2.3", true},
+		{"1.4", "1.4.1", true},
+		{"v1.4", "1.5.0", false},
+		{"1", "1.9.9", true},
+		{"1", "2.0.0", false},
+		{"^1.2", "1.2.0", true},
+		{"^1.2", "1.9.0", true},
+		{"^1.2", "2.0.0", false},
+		{"^1.2", "1.1.9", false},
+		{"^0.2.3", "0.2.9", true},
+		{"^0.2.3", "0.3.0", false},
+		{"^0.0.3", "0.0.4", false},
+		{"~1.2.3", "1.2.9", true},
+		{"~1.2.3", "1.3.0", false},
+		{"~1.2.3", "1.2.2", false},
+		{"~1", "1.9.0", true},
+		{"1.x", "1.5.0", true},
+		{"1.x", "2.0.0", false},
+		{"1.*", "1.0.0", true},
+		{"1.2.x", "1.3.0", false},
+		{"*", "3.1.4", true},
+		{">=1.0 <2.0", "1.5.0", true},
+		{">=1.0 <2.0", "2.0.0", false},
+		{">= 1.0, < 2.0", "0.9.0", false},
+		{">1.2", "1.2.9", false},
+		{">1.2", "1.3.0", true},
+		{">1.2.3", "1.2.4", true},
+		{"<=1.2", "1.2.9", true},
+		{"<=1.2", "1.3.0", false},
+		{"!=1.2.3", "1.2.3", false},
+		{"!=1.2.3", "1.2.4", true},
+		{"1.x || ^3.0", "3.2.0", true},
+		{"1.x || ^3.0", "2.2.0", false},
+		{"^1.2", "1.3.0-beta", false},
+		{"^1.2", "2.0.0-beta", false},
+		{">=1.3.0-beta", "1.3.0-beta.2", true},
+		{">=1.3.0-beta", "1.4.0-beta", false},
+		{"1.2.3+build.1", "1.2.3", true},
+	}
+	for _, c := range cases {
+		constraint, err := ParseConstraint(c.constraint)
+		if !assert.Nil(t, err, "Expected constraint %s to parse", c.constraint) {
+			continue
+		}
+		v, err := ParseSemVer(c.version)
+		if !assert.Nil(t, err, "Expected version %s to parse", c.version) {
+			continue
+		}
+		assert.Equal(t, c.expected, constraint.Check(v), "Expected %s matching %s to be %v", c.version, c.constraint, c.expected)
+	}
+}
+
+func TestParseConstraintInvalid(t *testing.T) {
+	for _, s := range []string{"master", "1.2.3.4", ">=foo", "^", "1..2"} {
+		_, err := ParseConstraint(s)
+		assert.NotNil(t, err, "Expected constraint %s to be invalid", s)
+	}
+}
+
+func TestConstraintBest(t *testing.T) {
+	assert := assert.New(t)
+	tags := []string{"v1.0.0", "v1.4.0", "v1.4.2", "v1.10.0", "v2.0.0-rc.1", "v2.0.0", "latest"}
+
+	c, _ := ParseConstraint("^1.2")
+	best, ok := c.Best(tags)
+	assert.True(ok)
+	assert.Equal("v1.10.0", best)
+
+	c, _ = ParseConstraint("v1.4")
+	best, ok = c.Best(tags)
+	assert.True(ok)
+	assert.Equal("v1.4.2", best)
+
+	c, _ = ParseConstraint("*")
+	best, ok = c.Best(tags)
+	assert.True(ok)
+	assert.Equal("v2.0.0", best)
+
+	c, _ = ParseConstraint("^3")
+	_, ok = c.Best(tags)
+	assert.False(ok)
+}
+
+func TestFromString(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal(TypeNone, FromString("").Kind)
+	assert.Equal(TypeSemVer, FromString("^1.4").Kind)
+	assert.Equal(TypeSemVer, FromString("v2").Kind)
+	assert.Equal(TypeSemVer, FromString("1234567").Kind)
+	assert.Equal(TypeRef, FromString("9c0db6583837118d5df7c2ae38ab1c194e434b35").Kind)
+	assert.Equal(TypeNamed, FromString("develop").Kind)
+}
+
+func TestIsCompatibleWith(t *testing.T) {
+	assert := assert.New(t)
+	assert.True(FromString("~1.4").IsCompatibleWith(FromString("v1.4.1")))
+	assert.False(FromString("~1.4").IsCompatibleWith(FromString("v1.5.0")))
+	assert.True(FromString("develop").IsCompatibleWith(FromString("develop")))
+	assert.False(FromString("develop").IsCompatibleWith(FromString("master")))
+}
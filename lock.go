@@ -0,0 +1,312 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/Masterminds/vcs"
+	"gopkg.in/yaml.v2"
+)
+
+var (
+	// locked contains the resolved repos from the lock file by name
+	locked = make(map[string]*LockedRepo)
+	// lockErr contains the error of reading the lock file of the project, it's nil once the lock is loaded
+	lockErr = fmt.Errorf("Lock file not loaded")
+)
+
+func resolveLockFilePath(dir string) string {
+	return filepath.Join(dir, "vgo.lock")
+}
+
+func resolveSumFilePath(dir string) string {
+	return filepath.Join(dir, "vgo.sum")
+}
+
+// RepoLock describes the resolved dependency graph stored in vgo.lock. It is generated and should not be edited by
+// hand, constraints belong in vgo.yaml.
+type RepoLock struct {
+	Deps []*LockedRepo `yaml:"deps,omitempty"`
+}
+
+// LockedRepo is a resolved dependency with the names of it's own dependencies
+type LockedRepo struct {
+	Name      string   `yaml:"name"`
+	URL       string   `yaml:"url,omitempty"`
+	Type      vcs.Type `yaml:"vcs,omitempty"`
+	Reference string   `yaml:"ref,omitempty"`
+	Hash      string   `yaml:"hash,omitempty"`
+	Deps      []string `yaml:"deps,omitempty"`
+
+	// Files contains the hash of each file in the repo, these are stored in vgo.sum
+	Files map[string]string `yaml:"-"`
+}
+
+// LockFile resolves the path to the lock file of the repo
+func (r *Repo) LockFile() string {
+	return resolveLockFilePath(filepath.Dir(r.ManifestFile()))
+}
+
+// SumFile resolves the path to the file checksums of the repo
+func (r *Repo) SumFile() string {
+	return resolveSumFilePath(filepath.Dir(r.ManifestFile()))
+}
+
+// LoadLock reads the lock and sum files and applies the resolved references to the dependency tree. Without a sum file
+// dependencies are only verified by their checksum in the lock file.
+func (r *Repo) LoadLock() error {
+	data, err := ioutil.ReadFile(r.LockFile())
+	if err != nil {
+		lockErr = err
+		return err
+	}
+	l := RepoLock{}
+	err = yaml.Unmarshal(data, &l)
+	if err != nil {
+		lockErr = fmt.Errorf("Unable to read %s: %s", r.LockFile(), err.Error())
+		return lockErr
+	}
+	lockErr = nil
+	for _, d := range l.Deps {
+		locked[d.Name] = d
+	}
+	r.applyLock()
+	err = r.loadSums()
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// loadSums reads the file checksums of the locked repos from the sum file. Each line holds the repo name, the path of
+// the file within the repo and it's hash.
+func (r *Repo) loadSums() error {
+	data, err := ioutil.ReadFile(r.SumFile())
+	if err != nil {
+		return err
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		// The path is enclosed by the first and last space as it may contain spaces itself
+		line := scanner.Text()
+		first, last := strings.Index(line, " "), strings.LastIndex(line, " ")
+		if first < 0 || first == last {
+			continue
+		}
+		l, ok := locked[line[:first]]
+		if !ok {
+			continue
+		}
+		if l.Files == nil {
+			l.Files = map[string]string{}
+		}
+		l.Files[line[first+1:last]] = line[last+1:]
+	}
+	return scanner.Err()
+}
+
+// applyLock sets the resolved reference of the repo and it's dependencies from the lock file
+func (r *Repo) applyLock() {
+	if l, ok := locked[r.Name]; ok && !r.IsRoot() {
+		r.Lock()
+		r.Reference = l.Reference
+		r.hash = l.Hash
+		r.Unlock()
+	}
+	for _, d := range r.Dependencies {
+		d.applyLock()
+	}
+}
+
+// applyDependencyLock locks the dependencies of the repo which the lock file of the project doesn't contain to the
+// references in the lock file of the repo, as long as these satisfy the versions required by other dependents
+func (r *Repo) applyDependencyLock() {
+	data, err := ioutil.ReadFile(r.LockFile())
+	if err != nil {
+		return
+	}
+	l := RepoLock{}
+	if yaml.Unmarshal(data, &l) != nil {
+		return
+	}
+	refs := map[string]string{}
+	for _, d := range l.Deps {
+		refs[d.Name] = d.Reference
+	}
+	r.RLock()
+	deps := r.Dependencies
+	r.RUnlock()
+	for _, d := range deps {
+		d.Lock()
+		if len(d.Reference) == 0 {
+			d.Reference = refs[d.Name]
+		}
+		d.Unlock()
+	}
+}
+
+// Locked builds the lock describing the resolved dependency graph of the repo. Test dependencies skipped with --no-dev
+// keep their entries of the previous lock, as do their own dependencies.
+func (r *Repo) Locked() RepoLock {
+	repos := map[string]*Repo{}
+	r.walk(repos)
+	skipped := r.skippedTestDeps()
+	l := RepoLock{}
+	kept := map[string]bool{}
+	var keep func(name string)
+	keep = func(name string) {
+		prev, ok := locked[name]
+		if !ok || kept[name] {
+			return
+		}
+		if _, ok := repos[name]; ok && !skipped[name] {
+			return
+		}
+		kept[name] = true
+		l.Deps = append(l.Deps, prev)
+		for _, dep := range prev.Deps {
+			keep(dep)
+		}
+	}
+	for name := range skipped {
+		keep(name)
+	}
+	for name, d := range repos {
+		if d.IsRoot() || kept[name] {
+			continue
+		}
+		d.RLock()
+		ld := &LockedRepo{
+			Name:      name,
+			Reference: d.Reference,
+			Hash:      d.hash,
+			Files:     d.files,
+		}
+		for _, dd := range d.Dependencies {
+			ld.Deps = append(ld.Deps, dd.Name)
+		}
+		repo, remote := d.repo, d.remote
+		d.RUnlock()
+		if repo != nil {
+			ld.URL = remote
+			ld.Type = repo.Vcs()
+		} else if prev, ok := locked[name]; ok {
+			ld.URL = prev.URL
+			ld.Type = prev.Type
+		}
+		if prev, ok := locked[name]; ok && ld.Files == nil && ld.Hash == prev.Hash {
+			ld.Files = prev.Files
+		}
+		sort.Strings(ld.Deps)
+		l.Deps = append(l.Deps, ld)
+	}
+	sort.Sort(lockedRepos(l.Deps))
+	return l
+}
+
+// skippedTestDeps lists the test dependencies of the project which weren't installed due to --no-dev
+func (r *Repo) skippedTestDeps() map[string]bool {
+	skipped := map[string]bool{}
+	if !noDev || !r.IsRoot() {
+		return skipped
+	}
+	r.RLock()
+	deps := r.Dependencies
+	r.RUnlock()
+	for _, d := range deps {
+		if d.test && !isScheduled(d.Name) {
+			skipped[d.Name] = true
+		}
+	}
+	return skipped
+}
+
+// skippedDeps extends the skipped test dependencies with the dependencies only they require, following both the
+// walked repos and the lock since the skipped ones aren't installed
+func (r *Repo) skippedDeps(repos map[string]*Repo) map[string]bool {
+	skipped := r.skippedTestDeps()
+	if len(skipped) == 0 {
+		return skipped
+	}
+	deps := func(name string) (names []string) {
+		if d, ok := repos[name]; ok {
+			d.RLock()
+			for _, dd := range d.Dependencies {
+				names = append(names, dd.Name)
+			}
+			d.RUnlock()
+		}
+		if l, ok := locked[name]; ok {
+			names = append(names, l.Deps...)
+		}
+		return names
+	}
+	required := map[string]bool{}
+	var require func(name string)
+	require = func(name string) {
+		if required[name] || skipped[name] {
+			return
+		}
+		required[name] = true
+		for _, dep := range deps(name) {
+			require(dep)
+		}
+	}
+	r.RLock()
+	direct := r.Dependencies
+	r.RUnlock()
+	for _, d := range direct {
+		require(d.Name)
+	}
+	var skip func(name string)
+	skip = func(name string) {
+		for _, dep := range deps(name) {
+			if !required[dep] && !skipped[dep] {
+				skipped[dep] = true
+				skip(dep)
+			}
+		}
+	}
+	for name := range r.skippedTestDeps() {
+		skip(name)
+	}
+	return skipped
+}
+
+// SaveLock writes the resolved dependency graph to the lock file and the file checksums to the sum file
+func (r *Repo) SaveLock() error {
+	l := r.Locked()
+	data, err := yaml.Marshal(l)
+	if err != nil {
+		return err
+	}
+	err = ioutil.WriteFile(r.LockFile(), data, os.FileMode(0644))
+	if err != nil {
+		return err
+	}
+	buf := bytes.Buffer{}
+	for _, d := range l.Deps {
+		paths := make([]string, 0, len(d.Files))
+		for path := range d.Files {
+			paths = append(paths, path)
+		}
+		sort.Strings(paths)
+		for _, path := range paths {
+			fmt.Fprintf(&buf, "%s %s %s\n", d.Name, path, d.Files[path])
+		}
+	}
+	return ioutil.WriteFile(r.SumFile(), buf.Bytes(), os.FileMode(0644))
+}
+
+// lockedRepos sorts locked repos by name
+type lockedRepos []*LockedRepo
+
+func (l lockedRepos) Len() int           { return len(l) }
+func (l lockedRepos) Less(i, j int) bool { return l[i].Name < l[j].Name }
+func (l lockedRepos) Swap(i, j int)      { l[i], l[j] = l[j], l[i] }
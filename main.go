@@ -6,11 +6,13 @@ import (
 	"os/exec"
 	"path"
 	"path/filepath"
+	"runtime"
 	"strings"
 
 	"gopkg.in/yaml.v2"
 
 	"github.com/codegangsta/cli"
+	"github.com/whitecypher/vgo/lib/goimport"
 )
 
 var (
@@ -20,8 +22,10 @@ var (
 	cwd          = MustGetwd()
 	manifestPath = cwd
 	vendoring    = os.Getenv("GO15VENDOREXPERIMENT") == "1"
-	ingopath     = strings.HasPrefix(cwd, gosrcpath)
 	version      = "0.0.0"
+	readonly     = false
+	offline      = false
+	noDev        = false
 )
 
 func main() {
@@ -29,17 +33,25 @@ func main() {
 		installPath = path.Join(cwd, "vendor")
 	}
 
-	if !ingopath {
-		fmt.Println("Your project isn't in the gopath. We haven't tested this with VGO yet so we recommend you move you project into your gopath.")
-		os.Exit(1)
-	}
-
 	verbose = true
-	name, err := filepath.Rel(gosrcpath, cwd)
-	if err != nil {
-		name = filepath.Base(cwd)
+	// Projects outside of the GOPATH are named by the manifest or the --name option
+	name, ingopath := gopathName(cwd)
+	r := NewRepo(name, NoVersion(), nil, resolveManifestFilePath(cwd))
+	discover := func() {
+		// Imports are discovered for each platform and tag of the manifest, the dependencies are their union
+		for _, ctxt := range r.BuildContexts() {
+			if len(ctxt.Label) > 0 {
+				Logf("Discovering %s", ctxt.Label)
+			}
+			if len(r.Main) > 0 {
+				for _, m := range r.Main {
+					NewPkg(ctxt, path.Join(r.Name, m), cwd, nil)
+				}
+			} else {
+				NewPkg(ctxt, r.Name, cwd, nil)
+			}
+		}
 	}
-	r := NewRepo(name, nil, resolveManifestFilePath(cwd))
 
 	vgo := cli.NewApp()
 	vgo.Name = "vgo"
@@ -51,24 +63,93 @@ func main() {
 			Name:  "dry",
 			Usage: "Prevent updates to manifest for trial runs",
 		},
+		cli.IntFlag{
+			Name:  "jobs, j",
+			Value: runtime.NumCPU(),
+			Usage: "Number of dependencies to install in parallel",
+		},
+		cli.StringFlag{
+			Name:  "name",
+			Usage: "Import path of the project, required outside of the GOPATH unless set in the manifest",
+		},
+		cli.BoolFlag{
+			Name:  "no-dev",
+			Usage: "Skip installing the test dependencies of the project, for production builds",
+		},
+		cli.BoolFlag{
+			Name:   "offline",
+			Usage:  "Fail instead of accessing the network, only cached and vendored references are installed",
+			EnvVar: "VGO_OFFLINE",
+		},
 	}
 	vgo.Before = func(c *cli.Context) (err error) {
+		offline = c.Bool("offline")
+		noDev = c.Bool("no-dev")
+		goimport.Default.Offline = offline
+		LoadConfig()
 		r.LoadManifest()
+		if n := c.String("name"); len(n) > 0 {
+			r.Name = n
+			r.updateMap()
+		}
+		if !ingopath {
+			if len(r.Name) == 0 {
+				fmt.Println("Your project isn't in the gopath. Set it's import path using the name in vgo.yaml or the --name option.")
+				os.Exit(1)
+			}
+			dir, err := setupOverlay(cwd, r.Name)
+			if err != nil {
+				fmt.Printf("Unable to link %s into the gopath overlay with error %s\n", r.Name, err.Error())
+				os.Exit(1)
+			}
+			cwd = dir
+			manifestPath = dir
+			if vendoring {
+				installPath = path.Join(cwd, "vendor")
+			}
+		}
+		repoRoots.Dirs = []string{filepath.Join(cwd, "vendor"), installPath, gosrcpath}
+		repoRoots.Add(r.Name)
+		r.LoadLock()
+		JobQueue.Start(c.Int("jobs"))
 		return
 	}
+	// failure is the exit error of the command, returned once the manifest and lock are saved
+	var failure error
+	wait := func() bool {
+		if err := JobQueue.Finish(); err != nil {
+			failure = err
+		}
+		return failure == nil
+	}
 	vgo.After = func(c *cli.Context) (err error) {
+		wait()
+		if readonly {
+			return failure
+		}
 		if !c.Bool("dry") {
 			err = r.SaveManifest()
 			if err != nil {
 				fmt.Println(err.Error())
 			}
+			err = r.SaveLock()
+			if err != nil {
+				fmt.Println(err.Error())
+			}
 		} else {
-			// r.Print("  ", os.Stdout)
 			data, err := yaml.Marshal(r)
 			if err != nil {
 				fmt.Println(err.Error())
 			}
 			fmt.Println(string(data))
+			data, err = yaml.Marshal(r.Locked())
+			if err != nil {
+				fmt.Println(err.Error())
+			}
+			fmt.Println(string(data))
+		}
+		if failure != nil {
+			return failure
 		}
 		return err
 	}
@@ -84,13 +165,7 @@ func main() {
 			Usage:       "Discover dependencies",
 			Description: `Scan project for packages, install them if not already vendored and store results into vgo.yaml`,
 			Action: func(c *cli.Context) {
-				if len(r.Main) > 0 {
-					for _, m := range r.Main {
-						NewPkg(path.Join(name, m), cwd, nil)
-					}
-				} else {
-					NewPkg(name, cwd, nil)
-				}
+				discover()
 			},
 		},
 		{
@@ -104,6 +179,25 @@ func main() {
 				},
 			},
 			Action: func(c *cli.Context) {
+				update := c.Bool("u")
+				for _, arg := range c.Args() {
+					if arg == "./..." {
+						discover()
+						for _, d := range r.Dependencies {
+							if schedule(d.Name) {
+								JobQueue.Add(&RepoInstallJob{repo: d, update: update})
+							}
+						}
+						continue
+					}
+					name, version := parseDependency(arg)
+					err := r.Get(name, version, update)
+					if err != nil {
+						Logf("Package %s could not be installed with error %s", name, err.Error())
+						failure = cli.NewExitError(fmt.Sprintf("Package %s could not be installed", name), 1)
+					}
+				}
+				wait()
 			},
 		},
 		{
@@ -111,7 +205,217 @@ func main() {
 			Aliases:     []string{"rm"},
 			Usage:       "Remove a dependency",
 			Description: `Remove one or more dependencies matching the given paths`,
+			Flags: []cli.Flag{
+				cli.BoolFlag{
+					Name:  "force",
+					Usage: "Remove the dependency even when it is still imported by the project",
+				},
+			},
+			Action: func(c *cli.Context) {
+				for _, name := range c.Args() {
+					importers := Importers(name, cwd, r.BuildContexts())
+					if len(importers) > 0 {
+						if !c.Bool("force") {
+							Logf("Package %s is still imported by %s. Use --force to remove it anyway.", name, strings.Join(importers, ", "))
+							continue
+						}
+						Logf("WARN Package %s is still imported by %s", name, strings.Join(importers, ", "))
+					}
+					err := r.RemoveDep(name)
+					if err != nil {
+						Logf("Package %s could not be removed with error %s", name, err.Error())
+					}
+				}
+			},
+		},
+		{
+			Name:        "verify",
+			Usage:       "Verify vendored dependencies",
+			Description: `Recompute the checksums of all vendored dependencies and compare them with the lock file, exits with a non-zero status when any files were added, removed or modified`,
+			Action: func(c *cli.Context) {
+				if !r.Verify(os.Stdout) {
+					os.Exit(1)
+				}
+				readonly = true
+			},
+		},
+		{
+			Name:        "status",
+			Usage:       "Report drift of the vendored dependencies",
+			Description: `Compare the vendor directory with the manifest and lock file, exits with a non-zero status when any dependency is missing, dirty, checked out at a different reference, locked to a reference which no longer exists upstream or not in the manifest`,
+			Flags: []cli.Flag{
+				cli.BoolFlag{
+					Name:  "json",
+					Usage: "Print the status as json",
+				},
+			},
 			Action: func(c *cli.Context) {
+				readonly = true
+				statuses := r.Status()
+				err := PrintStatus(os.Stdout, statuses, c.Bool("json"))
+				if err != nil {
+					fmt.Println(err.Error())
+					os.Exit(1)
+				}
+				for _, s := range statuses {
+					if !s.OK() {
+						os.Exit(1)
+					}
+				}
+			},
+		},
+		{
+			Name:        "outdated",
+			Usage:       "List newer versions of the dependencies",
+			Description: `List the current reference, the newest tag satisfying the version and the newest tag overall for each dependency. Tags are read from the cache or vendor directory without cloning anything.`,
+			Flags: []cli.Flag{
+				cli.BoolFlag{
+					Name:  "update-check",
+					Usage: "Fetch the newest tags before listing them",
+				},
+			},
+			Action: func(c *cli.Context) {
+				readonly = true
+				err := PrintOutdated(os.Stdout, r.Outdated(c.Bool("update-check")))
+				if err != nil {
+					fmt.Println(err.Error())
+					os.Exit(1)
+				}
+			},
+		},
+		{
+			Name:        "why",
+			Usage:       "Show why a dependency is needed",
+			Description: `Print every shortest import chain from the main packages of the project to the given package or repo, with the file and line of each import`,
+			Action: func(c *cli.Context) {
+				readonly = true
+				for i, name := range c.Args() {
+					if i > 0 {
+						fmt.Println()
+					}
+					chains := r.Why(name)
+					if len(chains) == 0 {
+						fmt.Printf("%s is not imported by the project\n", name)
+						continue
+					}
+					PrintImportChains(os.Stdout, chains)
+				}
+			},
+		},
+		{
+			Name:        "graph",
+			Usage:       "Export the dependency graph",
+			Description: `Print the dependency graph of the project as dot, json or mermaid. Nodes carry the version and reference of their repo and edges list the packages which import the dependency.`,
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "format",
+					Value: "dot",
+					Usage: "Output format, one of dot, json or mermaid",
+				},
+				cli.BoolFlag{
+					Name:  "packages",
+					Usage: "Export the package level graph instead of the repo level graph",
+				},
+			},
+			Action: func(c *cli.Context) {
+				readonly = true
+				err := r.Graph(c.Bool("packages")).Write(os.Stdout, c.String("format"))
+				if err != nil {
+					fmt.Println(err.Error())
+					os.Exit(1)
+				}
+			},
+		},
+		{
+			Name:        "tree",
+			Usage:       "Print the dependency tree",
+			Description: `Print the dependency tree with the version, locked reference and dirty, missing or conflict markers of each dependency. Dependencies which were printed before are collapsed and marked with (*).`,
+			Flags: []cli.Flag{
+				cli.IntFlag{
+					Name:  "depth",
+					Value: -1,
+					Usage: "Maximum depth of the tree, the whole tree is printed by default",
+				},
+				cli.StringFlag{
+					Name:  "invert",
+					Usage: "Print the dependents of the given package instead",
+				},
+			},
+			Action: func(c *cli.Context) {
+				readonly = true
+				if name := c.String("invert"); len(name) > 0 {
+					err := r.PrintInverted(os.Stdout, name, c.Int("depth"))
+					if err != nil {
+						fmt.Println(err.Error())
+						os.Exit(1)
+					}
+					return
+				}
+				r.Print(os.Stdout, c.Int("depth"))
+			},
+		},
+		{
+			Name:        "prune",
+			Usage:       "Remove unused files from the vendored dependencies",
+			Description: `Remove unused packages, tests, examples and other files which aren't needed to build the project from the vendored dependencies, as configured by the prune section of the manifest. License and notice files are always kept.`,
+			Action: func(c *cli.Context) {
+				opts := defaultPrune
+				if r.Prune != nil {
+					opts = *r.Prune
+				}
+				err := r.PruneVendor(opts, c.GlobalBool("dry"), os.Stdout)
+				if err != nil {
+					fmt.Println(err.Error())
+					os.Exit(1)
+				}
+			},
+		},
+		{
+			Name:        "import",
+			Usage:       "Import the dependencies of another tool",
+			Description: `Translate the names, versions, revisions and source urls from the manifest and lock files of dep, glide, godep, govendor or go modules (go.mod and go.sum) into vgo.yaml and vgo.lock. Run vgo afterwards to install the imported references.`,
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "from",
+					Usage: "Tool to import from, one of dep, glide, godep, govendor or gomod. Detected from the files in the project by default.",
+				},
+			},
+			Action: func(c *cli.Context) {
+				var err error
+				format := c.Args().First()
+				if len(format) == 0 {
+					format = c.String("from")
+				}
+				if len(format) == 0 {
+					format, err = DetectImportFormat(cwd)
+				}
+				var imported []*ImportedRepo
+				if err == nil {
+					imported, err = ReadImport(cwd, format)
+				}
+				if err != nil {
+					fmt.Println(err.Error())
+					os.Exit(1)
+				}
+				Logf("Importing %d dependencies from %s", len(imported), format)
+				r.Import(imported)
+			},
+		},
+		{
+			Name:        "export",
+			Usage:       "Export the dependencies to another format",
+			Description: `Write go.mod and go.sum for go modules from the locked references of the dependencies. Versions are the version tags of the locked commits, or pseudo-versions for commits without one. The go.sum hashes are computed from the vendored files.`,
+			Action: func(c *cli.Context) {
+				readonly = true
+				if format := c.Args().First(); format != "gomod" {
+					fmt.Printf("Unknown export format %s, expected gomod\n", format)
+					os.Exit(1)
+				}
+				err := r.ExportGoMod(c.GlobalBool("dry"), os.Stdout)
+				if err != nil {
+					fmt.Println(err.Error())
+					os.Exit(1)
+				}
 			},
 		},
 		{
@@ -149,15 +453,18 @@ func main() {
 	vgo.Action = func(c *cli.Context) {
 		if r.hasManifest {
 			r.InstallDeps()
-		} else {
-			Log("No manifest found. Running discover task.")
-			if len(r.Main) > 0 {
-				for _, m := range r.Main {
-					NewPkg(path.Join(name, m), cwd, nil)
+			if !wait() {
+				return
+			}
+			if r.Prune != nil {
+				err := r.PruneVendor(*r.Prune, c.Bool("dry"), os.Stdout)
+				if err != nil {
+					Logf("FAIL Pruning failed with error %s", err.Error())
 				}
-			} else {
-				NewPkg(name, cwd, nil)
 			}
+		} else {
+			Log("No manifest found. Running discover task.")
+			discover()
 		}
 		// pass command through to go
 		args := c.Args()
@@ -172,5 +479,5 @@ func main() {
 			cmd.Run()
 		}
 	}
-	vgo.Run(os.Args)
+	cli.HandleExitCoder(vgo.Run(os.Args))
 }
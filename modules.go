@@ -0,0 +1,204 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/Masterminds/vcs"
+
+	"github.com/whitecypher/vgo/lib/checksum"
+	"github.com/whitecypher/vgo/lib/gomod"
+	semver "github.com/whitecypher/vgo/lib/version"
+)
+
+// ExportGoMod writes go.mod and go.sum next to the manifest, replacing existing files. When dry they are printed to w
+// instead.
+func (r *Repo) ExportGoMod(dry bool, w io.Writer) error {
+	f, sums, err := r.GoMod()
+	if err != nil {
+		return err
+	}
+	files := []struct {
+		name string
+		data []byte
+	}{
+		{"go.mod", f.Format()},
+		{"go.sum", gomod.FormatSum(sums)},
+	}
+	dir := filepath.Dir(r.ManifestFile())
+	for _, file := range files {
+		if dry {
+			fmt.Fprintf(w, "%s:\n%s\n", file.name, file.data)
+			continue
+		}
+		err = ioutil.WriteFile(filepath.Join(dir, file.name), file.data, os.FileMode(0644))
+		if err != nil {
+			return err
+		}
+		Logf("OK %s", file.name)
+	}
+	return nil
+}
+
+// GoMod builds the go.mod and go.sum of the project from the locked references of the dependencies. Dependencies
+// which aren't required by the manifest of the project are marked indirect. The go.sum hashes are computed from the
+// vendored files, so dependencies which are pruned or differ from the lock are refused as their hashes wouldn't match
+// the module downloads.
+func (r *Repo) GoMod() (*gomod.File, []gomod.SumLine, error) {
+	repos := map[string]*Repo{}
+	r.walk(repos)
+	names := []string{}
+	for name, d := range repos {
+		if !d.IsRoot() {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	f := &gomod.File{Module: r.Name}
+	sums := []gomod.SumLine{}
+	for _, name := range names {
+		d := repos[name]
+		v, err := d.ModuleVersion()
+		if err != nil {
+			return nil, nil, err
+		}
+		err = d.checkModuleFiles()
+		if err != nil {
+			return nil, nil, err
+		}
+		f.Require = append(f.Require, gomod.Require{Path: name, Version: v, Indirect: r.Find(name) == nil})
+		h, err := gomod.HashDir(d.Path(), name, v)
+		if err != nil {
+			return nil, nil, err
+		}
+		// Dependencies without a go.mod file are hashed with the one synthesized by the go command
+		mod, _ := ioutil.ReadFile(filepath.Join(d.Path(), "go.mod"))
+		sums = append(sums,
+			gomod.SumLine{Path: name, Version: v, Hash: h},
+			gomod.SumLine{Path: name, Version: v + "/go.mod", Hash: gomod.HashGoMod(name, mod)},
+		)
+	}
+	return f, sums, nil
+}
+
+// ModuleVersion resolves the module version of the locked reference, which is the highest version tag of the commit or
+// a pseudo-version based on the nearest version tag of it's ancestors
+func (r *Repo) ModuleVersion() (string, error) {
+	repo, missing, _ := r.vendorState()
+	r.RLock()
+	ref := r.Reference
+	r.RUnlock()
+	if repo == nil || missing || len(ref) == 0 {
+		return "", fmt.Errorf("Dependency %s is not installed", r.Name)
+	}
+	tags, _ := repo.TagsFromCommit(ref)
+	if v, ok := highestVersion(tags); ok {
+		return r.incompatible(v), nil
+	}
+	info, err := repo.CommitInfo(ref)
+	if err != nil {
+		return "", err
+	}
+	base := ""
+	if repo.Vcs() == vcs.Git {
+		out, err := repo.RunFromDir("git", "describe", "--tags", "--abbrev=0", "--match", "v[0-9]*", ref)
+		if err == nil {
+			base = strings.TrimSpace(string(out))
+		}
+	}
+	return r.incompatible(gomod.PseudoVersion(gomod.PathMajor(r.Name), base, info.Date, info.Commit)), nil
+}
+
+// checkModuleFiles verifies the vendored files are those of the locked reference, unchanged and not pruned
+func (r *Repo) checkModuleFiles() error {
+	files, err := checksum.Files(r.Path())
+	if err != nil {
+		return err
+	}
+	if l, ok := locked[r.Name]; ok && len(l.Hash) > 0 && checksum.Sum(files) != l.Hash {
+		return fmt.Errorf("Dependency %s differs from the lock, use vgo verify to list the changes", r.Name)
+	}
+	repo, _, _ := r.vendorState()
+	r.RLock()
+	ref := r.Reference
+	r.RUnlock()
+	tracked, err := trackedFiles(repo, ref)
+	if err != nil {
+		return err
+	}
+	for _, name := range tracked {
+		if _, ok := files[name]; !ok {
+			return fmt.Errorf("Dependency %s is pruned, install it without pruning to export it's go.sum hash", r.Name)
+		}
+	}
+	return nil
+}
+
+// trackedFiles lists the slash separated paths of the files in the reference. Only git and hg are supported, nothing is
+// listed for other repository types.
+func trackedFiles(repo vcs.Repo, ref string) ([]string, error) {
+	if repo == nil {
+		return nil, nil
+	}
+	var out []byte
+	var err error
+	files := []string{}
+	switch repo.Vcs() {
+	case vcs.Git:
+		out, err = repo.RunFromDir("git", "ls-tree", "-r", "-z", ref)
+		for _, entry := range strings.Split(string(out), "\x00") {
+			// Entries are formatted as "<mode> <type> <object>\t<path>", submodules aren't blobs
+			i := strings.Index(entry, "\t")
+			if i >= 0 && strings.Contains(entry[:i], " blob ") {
+				files = append(files, entry[i+1:])
+			}
+		}
+	case vcs.Hg:
+		out, err = repo.RunFromDir("hg", "files", "-r", ref, "-0")
+		for _, name := range strings.Split(string(out), "\x00") {
+			if len(name) > 0 {
+				files = append(files, filepath.ToSlash(name))
+			}
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Unable to list the files of %s with error %s", ref, err.Error())
+	}
+	return files, nil
+}
+
+// incompatible marks versions from v2 onwards as incompatible when the repo is no module of that major version
+func (r *Repo) incompatible(v string) string {
+	sv, err := semver.ParseSemVer(v)
+	if err != nil || sv.Major < 2 || len(gomod.PathMajor(r.Name)) > 0 {
+		return v
+	}
+	if _, err := ioutil.ReadFile(filepath.Join(r.Path(), "go.mod")); err == nil {
+		return v
+	}
+	return v + "+incompatible"
+}
+
+// highestVersion finds the highest canonical module version among the tags
+func highestVersion(tags []string) (string, bool) {
+	best := ""
+	var bestVer semver.SemVer
+	for _, t := range tags {
+		if !gomod.IsCanonical(t) || strings.HasSuffix(t, "+incompatible") {
+			continue
+		}
+		v, err := semver.ParseSemVer(t)
+		if err != nil {
+			continue
+		}
+		if len(best) == 0 || v.Compare(bestVer) > 0 {
+			best, bestVer = t, v
+		}
+	}
+	return best, len(best) > 0
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"text/tabwriter"
+
+	"github.com/Masterminds/vcs"
+)
+
+// RepoOutdated describes the newer versions available for a dependency
+type RepoOutdated struct {
+	Name    string
+	Version Version
+	// Current is the highest tag pointing at the locked reference, or the reference itself when it isn't tagged
+	Current string
+	// Wanted is the newest tag satisfying the version constraint
+	Wanted string
+	// Latest is the newest tag which isn't a prerelease
+	Latest string
+}
+
+// Outdated lists the newest compatible and overall versions of all dependencies. Tags are read from the mirror in the
+// cache or otherwise from the vendor checkout, nothing is cloned. With updateCheck existing mirrors are fetched first.
+func (r *Repo) Outdated(updateCheck bool) []RepoOutdated {
+	repos := map[string]*Repo{}
+	r.walk(repos)
+	names := []string{}
+	for name, d := range repos {
+		if !d.IsRoot() {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	latest := VersionFromString("*")
+	list := []RepoOutdated{}
+	for _, name := range names {
+		d := repos[name]
+		d.RLock()
+		o := RepoOutdated{Name: name, Version: d.Version, Current: d.Reference}
+		d.RUnlock()
+		repo := d.tagSource(updateCheck)
+		if repo == nil {
+			Logf("WARN Unable to list the tags of %s, it is neither cached nor vendored", name)
+			list = append(list, o)
+			continue
+		}
+		tags, err := repo.Tags()
+		if err != nil {
+			Logf("WARN Unable to list the tags of %s with error %s", name, err.Error())
+		}
+		if len(o.Current) > 0 {
+			current, _ := repo.TagsFromCommit(o.Current)
+			if best, ok := latest.Best(current); ok {
+				o.Current = best
+			} else if len(current) > 0 {
+				o.Current = current[0]
+			}
+		}
+		o.Wanted, _ = o.Version.Best(tags)
+		o.Latest, _ = latest.Best(tags)
+		list = append(list, o)
+	}
+	return list
+}
+
+// tagSource resolves the mirror of the repo, or the vendor checkout when it isn't cached. Only existing mirrors are
+// updated, repos which aren't cached fall back to the tags of the vendor checkout rather than being cloned.
+func (r *Repo) tagSource(updateCheck bool) vcs.Repo {
+	checkout := repoFromPath(r.Path())
+	var m *Mirror
+	if l, ok := locked[r.Name]; ok && len(l.URL) > 0 {
+		m = NewMirror(l.Type, l.URL)
+	} else if checkout != nil {
+		m = NewMirror(checkout.Vcs(), mirrorURL(checkout.Remote()))
+	}
+	if m != nil && m.Exists() && updateCheck {
+		err := m.Update()
+		if err != nil {
+			Logf("WARN Unable to check %s for updates with error %s", r.Name, err.Error())
+		}
+	}
+	if m != nil && m.Exists() {
+		repo, err := newVCSRepo(m.Type, "", m.Path)
+		if err == nil && repo != nil {
+			return repo
+		}
+	}
+	return checkout
+}
+
+// PrintOutdated writes the current, wanted and latest versions of the dependencies as a table
+func PrintOutdated(w io.Writer, list []RepoOutdated) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tVERSION\tCURRENT\tWANTED\tLATEST")
+	for _, o := range list {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", o.Name, orDash(o.Version.String()), orDash(shortReference(o.Current)), orDash(o.Wanted), orDash(o.Latest))
+	}
+	return tw.Flush()
+}
+
+// orDash replaces empty table cells by a dash
+func orDash(s string) string {
+	if len(s) == 0 {
+		return "-"
+	}
+	return s
+}
@@ -3,14 +3,30 @@ package main
 import (
 	"fmt"
 	"go/build"
+	"os"
+	"path"
+	"path/filepath"
 	"strings"
 
+	"github.com/whitecypher/vgo/lib/goimport"
 	"github.com/whitecypher/vgo/lib/native"
+	"github.com/whitecypher/vgo/lib/reporoot"
 )
 
 var (
 	pkgmap = make(map[string]*Pkg)
 	depth  = 0
+	// testsDiscovered contains the packages of which test imports were discovered by build context and import path, as
+	// external tests import their own package
+	testsDiscovered = make(map[string]bool)
+	// repoRoots resolves the repository roots of import paths, the dirs to search are set once the install path is known
+	repoRoots = reporoot.NewResolver(func(importPath string) (string, error) {
+		i, err := goimport.Default.Resolve(importPath)
+		if err != nil {
+			return "", err
+		}
+		return i.Prefix, nil
+	})
 )
 
 // PkgNotFoundError ...
@@ -21,10 +37,17 @@ func (e PkgNotFoundError) Error() string {
 }
 
 // NewPkg ...
-func NewPkg(name, dir string, parent *Pkg) *Pkg {
+func NewPkg(ctxt *BuildContext, name, dir string, parent *Pkg) *Pkg {
+	return newPkg(ctxt, name, dir, parent, parent != nil && parent.test)
+}
+
+// newPkg creates the package, test is set for packages which are only imported by tests of the project
+func newPkg(ctxt *BuildContext, name, dir string, parent *Pkg, test bool) *Pkg {
 	// , repo *Repo
 	p := &Pkg{
 		parent: parent,
+		ctxt:   ctxt,
+		test:   test,
 		Name:   name,
 		Dir:    dir,
 		// Repo:   repo,
@@ -36,6 +59,8 @@ func NewPkg(name, dir string, parent *Pkg) *Pkg {
 // Pkg ...
 type Pkg struct {
 	parent *Pkg
+	ctxt   *BuildContext
+	test   bool
 
 	Name string
 	Dir  string
@@ -44,7 +69,7 @@ type Pkg struct {
 
 // Meta ...
 func (p *Pkg) Meta() (bp *build.Package, err error) {
-	bp, err = build.Import(p.Name, p.Dir, build.ImportMode(0))
+	bp, err = p.ctxt.Import(p.Name, p.Dir, build.ImportMode(0))
 	if bp == nil {
 		err = PkgNotFoundError(fmt.Sprintf("Unable to find package %s", p.Name))
 		return
@@ -62,24 +87,46 @@ func (p *Pkg) Init() {
 	if p.parent != nil {
 		rp = p.parent.Repo
 	}
-	p.Repo = NewRepo(p.RepoName(), rp)
+	p.Repo = NewRepo(p.RepoName(), NoVersion(), rp, "")
 	m, _ := p.Meta()
 
 	depth++
 	for _, i := range m.Imports {
-		if native.IsNative(i) {
-			continue
-		}
-		// fmt.Println(strings.Repeat("  ", depth), i)
-		dep := NewPkg(i, installPath, p)
-		if dep.RepoName() == p.RepoName() {
-			continue
+		p.addImport(i, p.test)
+	}
+	// Tests are only discovered for the packages of the project, not for those of dependencies
+	key := p.ctxt.Label + " " + m.ImportPath
+	if p.Repo.IsRoot() && !testsDiscovered[key] {
+		testsDiscovered[key] = true
+		for _, i := range append(append([]string{}, m.TestImports...), m.XTestImports...) {
+			p.addImport(i, true)
 		}
-		p.Repo.AddDep(dep.Repo)
 	}
 	depth--
 }
 
+// addImport discovers the imported package and adds it's repo as dependency. Dependencies of the project which are
+// only imported by tests are marked as test dependencies.
+func (p *Pkg) addImport(i string, test bool) {
+	if native.IsNative(i) {
+		return
+	}
+	// fmt.Println(strings.Repeat("  ", depth), i)
+	dep := newPkg(p.ctxt, i, installPath, p, test)
+	if dep.RepoName() == p.RepoName() {
+		return
+	}
+	if p.Repo.IsRoot() {
+		switch {
+		case !test:
+			dep.Repo.test = false
+		case !p.Repo.HasDep(dep.Repo):
+			dep.Repo.test = true
+		}
+	}
+	p.Repo.AddDep(dep.Repo)
+}
+
 // ImportName ...
 func (p *Pkg) ImportName() string {
 	// Remove any vendor path prefixes
@@ -92,17 +139,80 @@ func (p *Pkg) SubPath() string {
 	return strings.TrimPrefix(p.ImportName(), p.RepoName())
 }
 
-// RepoName ...
+// RepoName resolves the import path of the repository containing the package
 func (p *Pkg) RepoName() string {
-	// Limit root package name to 3 levels
-	parts := strings.Split(p.ImportName(), "/")
-	if len(parts) > 3 {
-		parts = parts[0:3]
-	}
-	return strings.Join(parts, "/")
+	return repoRoots.Root(p.ImportName())
 }
 
 // RepoPath ...
 func (p *Pkg) RepoPath() string {
 	return strings.TrimSuffix(p.Dir, p.SubPath())
 }
+
+// ProjectPkgs lists the packages contained in the project directory for the build context, excluding vendored packages
+func ProjectPkgs(ctxt *BuildContext, dir string) (pkgs []*build.Package) {
+	// The dir is a link when the project is in the GOPATH overlay, it's target is walked while importing through the link
+	root, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		root = dir
+	}
+	filepath.Walk(root, func(p string, info os.FileInfo, err error) error {
+		if err != nil || !info.IsDir() {
+			return nil
+		}
+		base := info.Name()
+		if p != root && (base == "vendor" || base == "testdata" || strings.HasPrefix(base, ".") || strings.HasPrefix(base, "_")) {
+			return filepath.SkipDir
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return nil
+		}
+		bp, err := ctxt.ImportDir(filepath.Join(dir, rel), build.ImportMode(0))
+		if err != nil {
+			return nil
+		}
+		pkgs = append(pkgs, bp)
+		return nil
+	})
+	return
+}
+
+// MainPkgs imports the main packages of the project for the build context, or all project packages when no main
+// packages are declared
+func (r *Repo) MainPkgs(ctxt *BuildContext) []*build.Package {
+	if len(r.Main) == 0 {
+		return ProjectPkgs(ctxt, cwd)
+	}
+	pkgs := []*build.Package{}
+	for _, m := range r.Main {
+		bp, err := ctxt.Import(path.Join(r.Name, m), cwd, build.ImportMode(0))
+		if err != nil {
+			Logf("WARN Unable to import main package %s with error %s", m, err.Error())
+			continue
+		}
+		pkgs = append(pkgs, bp)
+	}
+	return pkgs
+}
+
+// Importers lists the project packages in dir which import any package of the named repo in any of the build contexts
+func Importers(name, dir string, contexts []*BuildContext) []string {
+	importers := []string{}
+	for _, ctxt := range contexts {
+		for _, bp := range ProjectPkgs(ctxt, dir) {
+			for _, i := range bp.Imports {
+				if (&Pkg{Name: i}).RepoName() != name {
+					continue
+				}
+				importer := bp.ImportPath
+				if importer == "." {
+					importer = bp.Dir
+				}
+				importers = append(importers, importer)
+				break
+			}
+		}
+	}
+	return uniqueStrings(importers)
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"go/build"
+	"strings"
+)
+
+// BuildContext is a platform and set of build tags the packages of the project are imported for
+type BuildContext struct {
+	build.Context
+	// Label names the platform and tags, it's empty for the host platform without extra tags
+	Label string
+}
+
+// BuildContexts lists the host platform followed by the platforms and tags of the manifest. Each platform is combined
+// with each tag so files constrained to both are found as well. Platforms are given as GOOS or GOOS/GOARCH, in which
+// case the architecture of the host is used.
+func (r *Repo) BuildContexts() []*BuildContext {
+	platforms := [][2]string{{build.Default.GOOS, build.Default.GOARCH}}
+	for _, p := range r.Platforms {
+		parts := strings.SplitN(p, "/", 2)
+		platform := [2]string{parts[0], build.Default.GOARCH}
+		if len(parts) == 2 && len(parts[1]) > 0 {
+			platform[1] = parts[1]
+		}
+		if len(platform[0]) == 0 {
+			continue
+		}
+		platforms = append(platforms, platform)
+	}
+	tags := append([]string{""}, r.Tags...)
+
+	contexts := []*BuildContext{}
+	seen := map[string]bool{}
+	for i, p := range platforms {
+		for _, tag := range tags {
+			key := p[0] + "/" + p[1] + " " + tag
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			c := &BuildContext{Context: build.Default}
+			c.GOOS, c.GOARCH = p[0], p[1]
+			label := []string{}
+			if i > 0 {
+				label = append(label, p[0]+"/"+p[1])
+			}
+			if len(tag) > 0 {
+				c.BuildTags = append(append([]string{}, build.Default.BuildTags...), tag)
+				label = append(label, tag)
+			}
+			c.Label = strings.Join(label, " ")
+			contexts = append(contexts, c)
+		}
+	}
+	return contexts
+}
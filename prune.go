@@ -0,0 +1,243 @@
+package main
+
+import (
+	"fmt"
+	"go/build"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/whitecypher/vgo/lib/checksum"
+)
+
+var (
+	// defaultPrune is used by vgo prune when the manifest has no prune section
+	defaultPrune = PruneOptions{UnusedPkgs: true, Tests: true, Examples: true, NonGo: true}
+	// goExts contains the extensions of the files used by go build
+	goExts = map[string]bool{
+		".go": true, ".s": true, ".S": true, ".c": true, ".h": true, ".cc": true, ".cpp": true, ".cxx": true,
+		".hh": true, ".hpp": true, ".hxx": true, ".m": true, ".f": true, ".F": true, ".for": true, ".f90": true,
+		".syso": true, ".swig": true, ".swigcxx": true,
+	}
+	// exampleDirs contains the names of directories holding examples
+	exampleDirs = map[string]bool{"example": true, "examples": true, "_example": true, "_examples": true}
+)
+
+// PruneOptions describes which files are removed from the vendored repos by vgo prune. License and notice files,
+// manifests and files embedded by //go:embed directives are always kept.
+type PruneOptions struct {
+	// UnusedPkgs removes the packages which aren't imported by the project
+	UnusedPkgs bool `yaml:"unused-packages,omitempty"`
+	// Tests removes _test.go files and testdata directories
+	Tests bool `yaml:"tests,omitempty"`
+	// Examples removes example directories
+	Examples bool `yaml:"examples,omitempty"`
+	// NonGo removes all files which aren't used by go build e.g. documentation and assets
+	NonGo bool `yaml:"non-go,omitempty"`
+	// Keep lists patterns of paths within the vendor directory which are never removed e.g. github.com/foo/bar/assets/*
+	Keep []string `yaml:"keep,omitempty"`
+}
+
+// PruneVendor removes the files described by the prune options from the vendored repos and updates their checksums. The
+// files are only listed when dry is set.
+func (r *Repo) PruneVendor(opts PruneOptions, dry bool, w io.Writer) error {
+	repos := map[string]*Repo{}
+	r.walk(repos)
+	used := map[string]bool{}
+	if opts.UnusedPkgs {
+		for pkg := range r.packageImports(true) {
+			used[pkg] = true
+		}
+	}
+	names := []string{}
+	for name, d := range repos {
+		if !d.IsRoot() {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		d := repos[name]
+		if _, err := os.Stat(d.Path()); err != nil {
+			continue
+		}
+		files, err := d.prunable(opts, used)
+		if err != nil {
+			return err
+		}
+		if len(files) == 0 {
+			continue
+		}
+		if dry {
+			for _, f := range files {
+				fmt.Fprintf(w, "PRUNE %s\n", path.Join(name, f))
+			}
+			continue
+		}
+		for _, f := range files {
+			p := filepath.Join(d.Path(), filepath.FromSlash(f))
+			err = os.Remove(p)
+			if err != nil {
+				return err
+			}
+			removeEmptyDirs(filepath.Dir(p), d.Path())
+		}
+		fmt.Fprintf(w, "PRUNE %s %d files\n", name, len(files))
+		sums, err := checksum.Files(d.Path())
+		if err != nil {
+			return err
+		}
+		d.Lock()
+		d.files = sums
+		d.hash = checksum.Sum(sums)
+		d.Unlock()
+	}
+	return nil
+}
+
+// prunable lists the slash separated paths of the files to remove from the repo
+func (r *Repo) prunable(opts PruneOptions, used map[string]bool) (files []string, err error) {
+	root := r.Path()
+	// Repos of which no package is known to be used are skipped to prevent removing all of it
+	usedRepo := false
+	for pkg := range used {
+		usedRepo = usedRepo || hasPathPrefix(pkg, r.Name)
+	}
+	if opts.UnusedPkgs && !usedRepo {
+		Logf("WARN No package of %s is imported, skipping unused packages", r.Name)
+	}
+	embeds, err := r.embedPatterns(!opts.Tests)
+	if err != nil {
+		return nil, err
+	}
+	err = filepath.Walk(root, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if info.IsDir() {
+			name := info.Name()
+			if p != root && (checksum.IsVCSDir(name) || name == "vendor") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if isKept(path.Join(r.Name, rel), info.Name(), opts.Keep) || isEmbedded(rel, embeds) {
+			return nil
+		}
+		dir := path.Dir(rel)
+		if prunableFile(rel, info.Name(), opts) {
+			files = append(files, rel)
+		} else if opts.UnusedPkgs && usedRepo && goExts[path.Ext(rel)] && !used[path.Join(r.Name, dir)] {
+			files = append(files, rel)
+		}
+		return nil
+	})
+	return
+}
+
+// prunableFile checks whether the file is removed regardless of it's package being used
+func prunableFile(rel, name string, opts PruneOptions) bool {
+	segments := strings.Split(path.Dir(rel), "/")
+	for _, s := range segments {
+		if opts.Tests && s == "testdata" {
+			return true
+		}
+		if opts.Examples && exampleDirs[s] {
+			return true
+		}
+	}
+	if opts.Tests && strings.HasSuffix(name, "_test.go") {
+		return true
+	}
+	return opts.NonGo && !goExts[path.Ext(name)]
+}
+
+// embedPatterns collects the //go:embed patterns of the packages in the repo for all build contexts of the project,
+// keyed by the slash separated directory of the package
+func (r *Repo) embedPatterns(tests bool) (map[string][]string, error) {
+	root := r.Path()
+	ctxts := r.Root().BuildContexts()
+	patterns := map[string][]string{}
+	err := filepath.Walk(root, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			return nil
+		}
+		if p != root && (checksum.IsVCSDir(info.Name()) || info.Name() == "vendor") {
+			return filepath.SkipDir
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		for _, ctxt := range ctxts {
+			bp, err := ctxt.ImportDir(p, build.ImportComment)
+			if err != nil {
+				continue
+			}
+			list := append([]string{}, bp.EmbedPatterns...)
+			if tests {
+				list = append(append(list, bp.TestEmbedPatterns...), bp.XTestEmbedPatterns...)
+			}
+			if len(list) > 0 {
+				patterns[rel] = uniqueStrings(append(patterns[rel], list...))
+			}
+		}
+		return nil
+	})
+	return patterns, err
+}
+
+// isEmbedded checks whether the file is matched by the embed patterns of the package in it's directory or a parent,
+// patterns matching a directory embed all files within it
+func isEmbedded(rel string, embeds map[string][]string) bool {
+	for dir := path.Dir(rel); ; dir = path.Dir(dir) {
+		name := rel
+		if dir != "." {
+			name = strings.TrimPrefix(rel, dir+"/")
+		}
+		for _, pattern := range embeds[dir] {
+			pattern = strings.TrimPrefix(pattern, "all:")
+			for p := name; p != "."; p = path.Dir(p) {
+				if ok, _ := path.Match(pattern, p); ok {
+					return true
+				}
+			}
+		}
+		if dir == "." {
+			return false
+		}
+	}
+}
+
+// isKept checks whether the file must never be removed
+func isKept(p, name string, keep []string) bool {
+	upper := strings.ToUpper(name)
+	for _, prefix := range []string{"LICENSE", "LICENCE", "NOTICE", "COPYING", "PATENTS"} {
+		if strings.HasPrefix(upper, prefix) {
+			return true
+		}
+	}
+	if strings.HasPrefix(name, "vgo.") {
+		return true
+	}
+	for _, pattern := range keep {
+		for dir := p; dir != "." && dir != "/"; dir = path.Dir(dir) {
+			if ok, _ := path.Match(pattern, dir); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
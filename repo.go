@@ -6,25 +6,47 @@ import (
 	"io"
 	"io/ioutil"
 	"os"
+	"os/exec"
 	"path"
 	"path/filepath"
 	"strings"
 	"sync"
 
 	"github.com/Masterminds/vcs"
+	"github.com/whitecypher/vgo/lib/checksum"
+	"github.com/whitecypher/vgo/lib/goimport"
 	"gopkg.in/yaml.v2"
 )
 
-var repoMap = make(map[string]*Repo)
+var (
+	repoMap     = make(map[string]*Repo)
+	repoMapLock = sync.RWMutex{}
+	// installLocks prevents the same repo from being installed by multiple workers at once
+	installLocks     = make(map[string]*sync.Mutex)
+	installLocksLock = sync.Mutex{}
+	// scheduled contains the names of repos queued for installation during this run
+	scheduled     = make(map[string]bool)
+	scheduledLock = sync.Mutex{}
+	// vcsTypes maps the names used in go-import meta tags to their vcs type
+	vcsTypes = map[string]vcs.Type{
+		"git": vcs.Git,
+		"hg":  vcs.Hg,
+		"bzr": vcs.Bzr,
+		"svn": vcs.Svn,
+	}
+)
 
 // NewRepo creates and initializes a Repo
 func NewRepo(name string, version Version, parent *Repo, manifestFilePath string) *Repo {
+	repoMapLock.Lock()
+	defer repoMapLock.Unlock()
 	if r, ok := repoMap[name]; ok {
 		return r
 	}
 	r := &Repo{
 		parent:       parent,
 		Name:         name,
+		Version:      version,
 		manifestFile: manifestFilePath,
 	}
 	repoMap[name] = r
@@ -38,19 +60,30 @@ func NewRepo(name string, version Version, parent *Repo, manifestFilePath string
 type Repo struct {
 	sync.RWMutex `yaml:"-"`
 
-	meta         *build.Package `yaml:"-"`
-	repo         vcs.Repo       `yaml:"-"`
-	parent       *Repo          `yaml:"-"`
-	hasManifest  bool           `yaml:"-"`
-	manifestFile string         `yaml:"-"`
-	installed    bool           `yaml:"-"`
-
-	Name         string   `yaml:"name,omitempty"`
-	Main         []string `yaml:"main,omitempty"`
-	Version      Version  `yaml:"ver,omitempty"`
-	Reference    string   `yaml:"ref,omitempty"`
-	Dependencies []*Repo  `yaml:"deps,omitempty"`
-	URL          string   `yaml:"url,omitempty"`
+	meta         *build.Package    `yaml:"-"`
+	repo         vcs.Repo          `yaml:"-"`
+	mirror       *Mirror           `yaml:"-"`
+	remote       string            `yaml:"-"`
+	parent       *Repo             `yaml:"-"`
+	parentLock   sync.RWMutex      `yaml:"-"` // parent is set while other jobs walk the tree
+	hasManifest  bool              `yaml:"-"`
+	manifestFile string            `yaml:"-"`
+	installed    bool              `yaml:"-"`
+	test         bool              `yaml:"-"` // only imported by tests of the project, stored in test-deps
+	hash         string            `yaml:"-"`
+	files        map[string]string `yaml:"-"`
+
+	Name         string        `yaml:"name,omitempty"`
+	Main         []string      `yaml:"main,omitempty"`
+	Platforms    []string      `yaml:"platforms,omitempty"`
+	Tags         []string      `yaml:"tags,omitempty"`
+	Version      Version       `yaml:"-"` // stored inline as one of ver, branch, tag or rev
+	Reference    string        `yaml:"ref,omitempty"`
+	Dependencies []*Repo       `yaml:"deps,omitempty"`
+	URL          string        `yaml:"url,omitempty"`
+	Rewrite      []RewriteRule `yaml:"rewrite,omitempty"`
+	Prune        *PruneOptions `yaml:"prune,omitempty"`
+	Export       bool          `yaml:"export,omitempty"`
 	// UsedPkgs     Pkgs    `yaml:"-"`
 }
 
@@ -72,6 +105,74 @@ func (r *Repo) AddDep(dep *Repo) {
 	r.Dependencies = append(r.Dependencies, dep)
 }
 
+// RemoveDep removes the named dependency from the repo, deletes it from the vendor directory and prunes any
+// transitive dependencies no longer reachable from the project root
+func (r *Repo) RemoveDep(name string) error {
+	var dep *Repo
+	deps := []*Repo{}
+	r.Lock()
+	for _, d := range r.Dependencies {
+		if d.Name == name {
+			dep = d
+			continue
+		}
+		deps = append(deps, d)
+	}
+	r.Dependencies = deps
+	r.Unlock()
+	if dep == nil {
+		return fmt.Errorf("Dependency %s not found in %s", name, r.Name)
+	}
+	return r.Root().prune(dep)
+}
+
+// prune deletes the orphaned repo and it's dependencies from the vendor directory unless they are still reachable
+// from the repo
+func (r *Repo) prune(orphan *Repo) (err error) {
+	reachable := map[string]*Repo{}
+	r.walk(reachable)
+	orphans := map[string]*Repo{}
+	orphan.walk(orphans)
+	for name, o := range orphans {
+		if o.IsRoot() {
+			continue
+		}
+		if _, ok := reachable[name]; ok {
+			Logf("Keeping %s which is still required", name)
+			continue
+		}
+		Logf("Removing %s", name)
+		if e := os.RemoveAll(o.Path()); e != nil {
+			Logf("Failed to remove %s with error %s", o.Path(), e.Error())
+			err = e
+		}
+		removeEmptyDirs(filepath.Dir(o.Path()), filepath.Join(r.Path(), "vendor"))
+		repoMapLock.Lock()
+		delete(repoMap, name)
+		repoMapLock.Unlock()
+	}
+	return
+}
+
+// walk collects the repo and all repos reachable from it by name. Dependencies declared in the manifest of an
+// installed repo are loaded when not already known.
+func (r *Repo) walk(seen map[string]*Repo) {
+	if s, ok := seen[r.Name]; ok {
+		// Prefer the instance which was resolved when the same repo is required in multiple places
+		if len(s.Reference) == 0 && len(r.Reference) > 0 {
+			seen[r.Name] = r
+		}
+		return
+	}
+	seen[r.Name] = r
+	if len(r.Dependencies) == 0 && !r.IsRoot() {
+		r.LoadManifest()
+	}
+	for _, d := range r.Dependencies {
+		d.walk(seen)
+	}
+}
+
 // AddMain adds a main (entrypoint) package to the project manifest
 func (r *Repo) AddMain(path string) {
 	r.Main = append(r.Main, path)
@@ -91,7 +192,7 @@ func (r *Repo) RemoveMain(path string) {
 
 // Path calculates the install path for the repository
 func (r *Repo) Path() string {
-	if r.parent == nil {
+	if r.Parent() == nil {
 		return cwd
 	}
 	return path.Join(cwd, "vendor", r.Name)
@@ -100,10 +201,11 @@ func (r *Repo) Path() string {
 
 // Depth resolves the depth of the repo within the dependency tree
 func (r *Repo) Depth() int {
-	if r.parent == nil {
+	parent := r.Parent()
+	if parent == nil {
 		return 0
 	}
-	return r.parent.Depth() + 1
+	return parent.Depth() + 1
 }
 
 // FQN resolves the fully qualified package name. This is the equivalent to the name that go uses dependant on it's context.
@@ -119,29 +221,52 @@ func (r *Repo) FQN() string {
 
 // Root returns the topmost package (typically this is the application package)
 func (r *Repo) Root() *Repo {
-	if r.parent == nil {
+	parent := r.Parent()
+	if parent == nil {
 		return r
 	}
-	return r.parent.Root()
+	return parent.Root()
 }
 
 // IsRoot returns whether the pkg is the root pkg
 func (r *Repo) IsRoot() bool {
-	return r.parent == nil
+	return r.Parent() == nil
+}
+
+// Parent returns the dependent the instance of the repo belongs to, nil for the project
+func (r *Repo) Parent() *Repo {
+	r.parentLock.RLock()
+	defer r.parentLock.RUnlock()
+	return r.parent
+}
+
+// setParent moves the instance of the repo to the dependencies of the parent
+func (r *Repo) setParent(parent *Repo) {
+	r.parentLock.Lock()
+	r.parent = parent
+	r.parentLock.Unlock()
 }
 
 // IsInGoPath returns whether project and all vendored packages are contained in the $GOPATH
 func (r *Repo) IsInGoPath() bool {
-	if r.parent != nil {
-		return r.parent.IsInGoPath()
+	if parent := r.Parent(); parent != nil {
+		return parent.IsInGoPath()
 	}
 	return strings.HasPrefix(r.Path(), gosrcpath)
 }
 
+// ManifestFile resolves the path to the manifest file of the repo
+func (r *Repo) ManifestFile() string {
+	if r.manifestFile != "" {
+		return r.manifestFile
+	}
+	return resolveManifestFilePath(r.Path())
+}
+
 // LoadManifest ...
 func (r *Repo) LoadManifest() error {
 	r.hasManifest = false
-	data, err := ioutil.ReadFile(filepath.Join(r.Path(), r.manifestFile))
+	data, err := ioutil.ReadFile(r.ManifestFile())
 	if err != nil {
 		return err
 	}
@@ -154,24 +279,30 @@ func (r *Repo) LoadManifest() error {
 	r.hasManifest = true
 	r.updateDepsParents()
 	r.updateMap()
+	for _, d := range r.Dependencies {
+		d.applyLock()
+	}
+	if !r.IsRoot() {
+		r.applyDependencyLock()
+	}
 	return nil
 }
 
 // updateDepsParents resolves the parent (caller) pkg for all dependencies recursively
 func (r *Repo) updateDepsParents() {
 	for _, d := range r.Dependencies {
-		d.Lock()
-		d.parent = r
-		d.Unlock()
+		d.setParent(r)
 		d.updateDepsParents()
 	}
 }
 
 // updateMap ...
 func (r *Repo) updateMap() {
-	if _, ok := repos[r.Name]; !ok {
-		repos[r.Name] = r
+	repoMapLock.Lock()
+	if _, ok := repoMap[r.Name]; !ok {
+		repoMap[r.Name] = r
 	}
+	repoMapLock.Unlock()
 	for _, d := range r.Dependencies {
 		d.updateMap()
 	}
@@ -184,8 +315,8 @@ func (r *Repo) Find(name string) *Repo {
 			return d
 		}
 	}
-	if r.parent != nil {
-		return (*r.parent).Find(name)
+	if parent := r.Parent(); parent != nil {
+		return parent.Find(name)
 	}
 	return nil
 }
@@ -196,7 +327,7 @@ func (r *Repo) SaveManifest() error {
 	if err != nil {
 		return err
 	}
-	err = ioutil.WriteFile(filepath.Join(r.Path(), r.manifestFile), data, os.FileMode(0644))
+	err = ioutil.WriteFile(r.ManifestFile(), data, os.FileMode(0644))
 	if err != nil {
 		return err
 	}
@@ -205,43 +336,169 @@ func (r *Repo) SaveManifest() error {
 
 // Install the package
 func (r *Repo) Install() error {
-	if r.parent == nil {
+	return r.install(false)
+}
+
+// Update installs the package and moves it to the newest reference compatible with it's version
+func (r *Repo) Update() error {
+	return r.install(true)
+}
+
+func (r *Repo) install(update bool) error {
+	if r.IsRoot() {
 		// Logf(strings.Repeat("  ", r.Depth())+"NOOP Skipping project root %s", r.Name)
 		// don't touch the current working directory
 		return nil
 	}
+	l := installLock(r.Name)
+	l.Lock()
+	defer l.Unlock()
+	err := r.fetch()
+	if err != nil {
+		return err
+	}
+	return r.Checkout(update)
+}
+
+// fetch clones the repo into the vendor directory when not yet installed
+func (r *Repo) fetch() error {
 	repo, err := r.VCS()
 	if repo == nil {
 		return fmt.Errorf("Could not resolve repo for %s with error %s", r.Name, err)
 	}
+	if r.isExported() {
+		if !r.mirror.Exists() {
+			Logf("Installing %s", r.Name)
+		}
+		return r.mirror.Get()
+	}
 	r.installed = repo.CheckLocal()
 	if !r.installed {
 		Logf("Installing %s", r.Name)
+		if r.mirror != nil {
+			err = r.mirror.Get()
+		} else if offline {
+			err = fmt.Errorf("Unable to install %s in offline mode, %s repositories are not cached", r.Name, repo.Vcs())
+		}
+		if err == nil {
+			// Replace an exported copy from before vendoring with metadata
+			err = r.removeExport()
+		}
+		if err != nil {
+			Logf("Failed to install %s with error %s", r.Name, err.Error())
+			return err
+		}
 		err = repo.Get()
 		if err != nil {
 			Logf("Failed to install %s with error %s, %s", r.Name, err.Error(), r.Path())
 		}
 	}
-	r.Checkout(false)
 	return err
 }
 
-// InstallDeps install package dependencies
-func (r *Repo) InstallDeps() (err error) {
-	wg := sync.WaitGroup{}
-	for _, dep := range r.Dependencies {
-		d := dep
-		wg.Add(1)
-		// go func() {
-		err = d.Install()
+// Get adds the named dependency to the root repo, or updates the existing one, and checks out the newest reference
+// compatible with the given version. An update is implied when the version differs from the one in the manifest. A
+// ConflictError is returned without changing anything when the version conflicts with those of other dependents.
+func (r *Repo) Get(name string, version Version, update bool) error {
+	root := r.Root()
+	// The manifests of all dependents are loaded first, as the version has to satisfy theirs as well
+	root.walk(map[string]*Repo{})
+	dep := root.Find(name)
+	if len(version.String()) > 0 {
+		check := dep
+		if check == nil {
+			check = &Repo{Name: name, parent: root}
+		}
+		err := check.checkVersion(version)
 		if err != nil {
-			Logf("Package %s could not be installed with error", err.Error())
+			return err
 		}
-		wg.Done()
-		// }()
 	}
-	wg.Wait()
-	return
+	if dep == nil {
+		dep = NewRepo(name, version, root, "")
+		dep.setParent(root)
+		root.AddDep(dep)
+	}
+	if len(version.String()) > 0 && version.String() != dep.Version.String() {
+		dep.Lock()
+		dep.Version = version
+		dep.Unlock()
+		update = true
+	}
+	schedule(dep.Name)
+	// A locked reference that no longer satisfies the version (e.g. after manual changes to the manifest) implies an update
+	if !update && len(dep.Reference) > 0 {
+		l := installLock(dep.Name)
+		l.Lock()
+		if dep.fetch() == nil {
+			repo, err := dep.VCS()
+			if err == nil && !isCompatibleReference(repo, verifyVersion(repo, dep.Version), dep.Reference) {
+				Logf("WARN Reference %s is not compatible with %s for dependency %s", dep.Reference, dep.Version, dep.Name)
+				update = true
+			}
+		}
+		l.Unlock()
+	}
+	if update {
+		return dep.Update()
+	}
+	return dep.Install()
+}
+
+// InstallDeps queues the installation of the package dependencies. Dependencies are only queued once per run, use
+// JobQueue.Wait to wait for all of them to be installed. Test dependencies of the project are skipped with --no-dev.
+// Dependencies which are queued already are checked against the version required by the repo instead.
+func (r *Repo) InstallDeps() {
+	r.RLock()
+	deps := r.Dependencies
+	r.RUnlock()
+	for _, d := range deps {
+		if noDev && d.test && r.IsRoot() {
+			Logf("NOOP Skipping test dependency %s", d.Name)
+			continue
+		}
+		if !schedule(d.Name) {
+			// The repo is installed for another dependent, it's checkout has to satisfy this version as well
+			d.RLock()
+			constrained := d.Version.Kind != VersionTypeNone
+			d.RUnlock()
+			if constrained {
+				JobQueue.Add(&RepoConstrainJob{repo: d})
+			}
+			continue
+		}
+		JobQueue.Add(&RepoInstallJob{repo: d})
+	}
+}
+
+// schedule marks the named repo as scheduled for installation, returns false if it already was
+func schedule(name string) bool {
+	scheduledLock.Lock()
+	defer scheduledLock.Unlock()
+	if scheduled[name] {
+		return false
+	}
+	scheduled[name] = true
+	return true
+}
+
+// isScheduled checks whether the named repo was queued for installation during this run
+func isScheduled(name string) bool {
+	scheduledLock.Lock()
+	defer scheduledLock.Unlock()
+	return scheduled[name]
+}
+
+// installLock returns the lock guarding the installation of the named repo
+func installLock(name string) *sync.Mutex {
+	installLocksLock.Lock()
+	defer installLocksLock.Unlock()
+	l, ok := installLocks[name]
+	if !ok {
+		l = &sync.Mutex{}
+		installLocks[name] = l
+	}
+	return l
 }
 
 // RelPath returns the path to package relative to the root package
@@ -251,55 +508,229 @@ func (r *Repo) RelPath() string {
 
 // Checkout switches the package version to the commit nearest maching the Compat string
 func (r *Repo) Checkout(update bool) error {
-	if r.parent == nil {
+	if r.IsRoot() {
 		Logf(strings.Repeat("  ", r.Depth()-1)+"NOOP Skipping project root %s", r.Name)
 		// don't touch the current working directory
 		return nil
 	}
+	if r.isExported() {
+		return r.export(update)
+	}
 	repo, err := r.VCS()
 	if err != nil {
 		return err
 	}
-	if repo.IsDirty() {
+	if isDirty(repo) {
 		Logf(strings.Repeat("  ", r.Depth()-1)+"NOOP Skipping checkout for %s. Dependency is dirty.", r.Name)
+		return fmt.Errorf("Dependency %s is dirty", r.Name)
 	}
+	// The versions required by all dependents are gathered before locking the repo, as it is one of them
+	cs := verifyConstraints(repo, r.Constraints())
 	r.Lock()
-	defer r.Unlock()
-	version := r.Version
-	if r.Reference != "" {
-		version = VersionFromString(r.Reference)
-	}
 	r.installed = repo.CheckLocal()
 	if !r.installed {
+		r.Unlock()
 		Logf(strings.Repeat("  ", r.Depth()-1)+"WARN Dependency %s not installed", r.Name)
 		return fmt.Errorf("Dependency %s not installed", r.Name)
 	}
-	v := version.String()
-	if len(v) > 0 {
-		if repo.IsReference(v) {
-			err = repo.UpdateVersion(v)
+	r.Version = verifyVersion(repo, r.Version)
+	// Locked references are installed as is, only updates resolve a new reference
+	ref := r.Reference
+	if len(ref) > 0 && !update && repo.IsReference(ref) && !satisfies(repo, ref, cs) {
+		Logf(strings.Repeat("  ", r.Depth()-1)+"WARN Reference %s of %s is not compatible with all dependents, resolving again", shortReference(ref), r.Name)
+		ref = ""
+	}
+	if update || len(ref) == 0 {
+		if update {
+			err = r.pull(repo, "")
 			if err != nil {
-				Logf(strings.Repeat("  ", r.Depth()-1)+"FAIL Checkout failed with error %s", err.Error())
+				r.Unlock()
+				Logf(strings.Repeat("  ", r.Depth()-1)+"FAIL Update failed with error %s", err.Error())
 				return err
 			}
-		} else {
-			Logf(strings.Repeat("  ", r.Depth()-1)+"WARN Reference %s not found for dependency %s", v, r.Name)
 		}
-	}
-	if update {
-		err = repo.Update()
+		ref, err = resolveConstraints(repo, r.Name, cs)
 		if err != nil {
-			Logf(strings.Repeat("  ", r.Depth()-1)+"FAIL Update failed with error %s", err.Error())
+			r.Unlock()
+			Logf(strings.Repeat("  ", r.Depth()-1)+"FAIL %s", err.Error())
 			return err
 		}
 	}
+	if len(ref) > 0 && !repo.IsReference(ref) && !update {
+		// The locked reference may have been resolved elsewhere and not be fetched yet
+		err = r.pull(repo, ref)
+		if err != nil && offline {
+			r.Unlock()
+			Logf(strings.Repeat("  ", r.Depth()-1)+"FAIL %s", err.Error())
+			return err
+		}
+	}
+	if len(ref) > 0 {
+		if repo.IsReference(ref) {
+			err = repo.UpdateVersion(ref)
+			if err != nil {
+				r.Unlock()
+				Logf(strings.Repeat("  ", r.Depth()-1)+"FAIL Checkout failed with error %s", err.Error())
+				return err
+			}
+		} else {
+			Logf(strings.Repeat("  ", r.Depth()-1)+"WARN Reference %s not found for dependency %s", ref, r.Name)
+		}
+	}
 	r.Reference, err = repo.Version()
+	if err == nil {
+		r.files, err = checksum.Files(r.Path())
+		r.hash = checksum.Sum(r.files)
+	}
 	Logf(strings.Repeat("  ", r.Depth()-1)+"OK %s %s", r.Reference, r.Name)
+	r.Unlock()
+	r.shareReference()
 	r.LoadManifest()
 	r.InstallDeps()
 	return err
 }
 
+// pull fetches new references into the checkout. References already in the mirror are fetched without network access,
+// an empty reference always updates the mirror from the remote first. In offline mode updates are limited to the
+// references in the mirror.
+func (r *Repo) pull(repo vcs.Repo, ref string) error {
+	if offline {
+		if r.mirror == nil || (len(ref) > 0 && !r.mirror.HasReference(ref)) {
+			return fmt.Errorf("Reference %s of %s is not available in offline mode", ref, r.Name)
+		}
+	} else if r.mirror != nil && (len(ref) == 0 || !r.mirror.HasReference(ref)) {
+		err := r.mirror.Update()
+		if err != nil {
+			return err
+		}
+	}
+	if r.isExported() {
+		// Exported repos are read from the mirror directly
+		return nil
+	}
+	return repo.Update()
+}
+
+// isDirty checks the repo for local changes. Deleted files are ignored for git repos as vendored repos may be pruned.
+func isDirty(repo vcs.Repo) bool {
+	if repo.Vcs() != vcs.Git {
+		return repo.IsDirty()
+	}
+	out, err := repo.RunFromDir("git", "status", "--porcelain", "--untracked-files=no")
+	if err != nil {
+		return true
+	}
+	for _, line := range strings.Split(string(out), "\n") {
+		if len(line) > 2 && line[:2] != " D" {
+			return true
+		}
+	}
+	return false
+}
+
+// verifyVersion resolves the kind of a version against the repo. Versions given as plain strings are assumed to be
+// branches unless they are constraints or commit hashes, so these are corrected to tags or commits where needed.
+// Explicitly declared kinds are kept, even when a branch and tag share the name.
+func verifyVersion(repo vcs.Repo, v Version) Version {
+	if !v.guessed {
+		return v
+	}
+	if hasReference(repo.Branches, v.Ref) {
+		v.Kind = VersionTypeBranch
+	} else if hasReference(repo.Tags, v.Ref) {
+		v.Kind = VersionTypeTag
+	} else if repo.IsReference(v.Ref) {
+		v.Kind = VersionTypeRef
+	}
+	return v
+}
+
+// hasReference checks whether the reference is contained in the list of references
+func hasReference(list func() ([]string, error), ref string) bool {
+	refs, err := list()
+	if err != nil {
+		return false
+	}
+	for _, r := range refs {
+		if r == ref {
+			return true
+		}
+	}
+	return false
+}
+
+// resolveReference finds the newest reference in the repo compatible with the version. Version constraints resolve to
+// the highest matching tag and branches to their most recent commit, while tags and commits never move.
+func resolveReference(repo vcs.Repo, v Version) (string, error) {
+	ref := v.String()
+	switch v.Kind {
+	case VersionTypeNone:
+		return latestReference(repo), nil
+	case VersionTypeSemVer:
+		tags, err := repo.Tags()
+		if err != nil {
+			return "", err
+		}
+		if best, ok := v.Best(tags); ok {
+			return best, nil
+		}
+	case VersionTypeBranch:
+		ref = branchReference(repo, ref)
+	}
+	if repo.IsReference(ref) {
+		return ref, nil
+	}
+	return "", fmt.Errorf("No reference compatible with %s found in %s", v, repo.Remote())
+}
+
+// latestReference returns the reference pointing to the tip of the default branch for the repo type
+func latestReference(repo vcs.Repo) string {
+	switch repo.Vcs() {
+	case vcs.Git:
+		if !repo.IsReference("origin/HEAD") {
+			// Mirrors track the remote branches locally
+			return "HEAD"
+		}
+		return "origin/HEAD"
+	case vcs.Hg:
+		return "default"
+	}
+	return ""
+}
+
+// branchReference returns the reference pointing to the tip of the branch. Git clones only track the default branch
+// locally so the remote tracking branch is used instead.
+func branchReference(repo vcs.Repo, branch string) string {
+	if repo.Vcs() == vcs.Git && repo.IsReference("origin/"+branch) {
+		return "origin/" + branch
+	}
+	return branch
+}
+
+// isCompatibleReference checks whether the checked out reference satisfies the version. Any commit on a branch is
+// compatible with the branch, while tags and commits only match themselves.
+func isCompatibleReference(repo vcs.Repo, v Version, ref string) bool {
+	switch v.Kind {
+	case VersionTypeNone:
+		return true
+	case VersionTypeSemVer:
+		tags, _ := repo.TagsFromCommit(ref)
+		for _, tag := range tags {
+			if v.IsCompatibleWith(VersionFromString(tag)) {
+				return true
+			}
+		}
+		return false
+	case VersionTypeBranch:
+		if repo.Vcs() == vcs.Git {
+			_, err := repo.RunFromDir("git", "merge-base", "--is-ancestor", ref, branchReference(repo, v.Ref))
+			return err == nil
+		}
+	}
+	info, err := repo.CommitInfo(v.Ref)
+	return err == nil && strings.HasPrefix(info.Commit, ref)
+}
+
 // VCS resolves the vcs.Repo for the Repo
 func (r *Repo) VCS() (repo vcs.Repo, err error) {
 	r.Lock()
@@ -309,45 +740,92 @@ func (r *Repo) VCS() (repo vcs.Repo, err error) {
 		return
 	}
 	repoType := r.RepoType()
-	repoURL := r.RepoURL()
+	r.remote = r.RepoURL()
+	// Dependencies are cloned from their mirror in the shared cache when supported
+	repoURL := r.remote
+	r.mirror = NewMirror(repoType, r.remote)
+	if r.mirror != nil {
+		repoURL = r.mirror.Path
+	}
+	if r.isExported() {
+		// Exported repos have no metadata so the mirror is used instead
+		if r.mirror == nil {
+			return nil, fmt.Errorf("Unable to export %s, only git and hg repositories can be vendored without metadata", r.Name)
+		}
+		repo, err = r.mirror.vcsRepo()
+		r.repo = repo
+		return
+	}
 	repoPath := r.Path()
+	repo, err = newVCSRepo(repoType, repoURL, repoPath)
+	if err == vcs.ErrWrongRemote && r.mirror != nil && !r.mirror.Exists() {
+		// The checkout keeps it's url until the mirror exists, so it isn't pointed to a missing mirror
+		repo, err = newVCSRepo(repoType, "", repoPath)
+	} else if err == vcs.ErrWrongRemote {
+		// The url was rewritten or the repo was installed before using the cache
+		if repoType == vcs.Git {
+			out, e := exec.Command("git", "-C", repoPath, "remote", "set-url", "origin", repoURL).CombinedOutput()
+			if e != nil {
+				return nil, fmt.Errorf("Unable to change the url of %s to %s with error %s", r.Name, repoURL, out)
+			}
+			repo, err = newVCSRepo(repoType, repoURL, repoPath)
+		} else {
+			Logf("WARN Keeping the existing url of %s, rewriting to %s is only supported for git", r.Name, repoURL)
+			repo, err = newVCSRepo(repoType, "", repoPath)
+		}
+	}
+	if err == nil && repo == nil {
+		err = fmt.Errorf("Unable to resolve the repository type of %s", r.Name)
+	}
+	r.repo = repo
+	return
+}
+
+func newVCSRepo(repoType vcs.Type, repoURL, repoPath string) (vcs.Repo, error) {
 	switch repoType {
 	case vcs.Git:
-		repo, err = vcs.NewGitRepo(repoURL, repoPath)
+		return vcs.NewGitRepo(repoURL, repoPath)
 	case vcs.Bzr:
-		repo, err = vcs.NewBzrRepo(repoURL, repoPath)
+		return vcs.NewBzrRepo(repoURL, repoPath)
 	case vcs.Hg:
-		repo, err = vcs.NewHgRepo(repoURL, repoPath)
+		return vcs.NewHgRepo(repoURL, repoPath)
 	case vcs.Svn:
-		repo, err = vcs.NewSvnRepo(repoURL, repoPath)
+		return vcs.NewSvnRepo(repoURL, repoPath)
 	}
-	r.repo = repo
-	return
+	return nil, nil
 }
 
 // PathOptions returns a list of possible locations to find the repo
 func (r *Repo) PathOptions() []string {
 	pathOptions := []string{r.Path()}
 	pathOptions = append(pathOptions, filepath.Join(r.Path(), "vendor", r.Name))
-	parent := r.parent
+	parent := r.Parent()
 	// Climb tree to find possible parent vendor dirs
 	for parent != nil {
 		pathOptions = append(pathOptions, filepath.Join(parent.Path(), "vendor", r.Name))
-		parent = parent.parent
+		parent = parent.Parent()
 	}
 	pathOptions = append(pathOptions, filepath.Join(gopath, "src", r.Name))
 	return pathOptions
 }
 
-// RepoURL creates the repo url from the package import path
+// RepoURL creates the repo url from the package import path and applies the rewrite rules
 func (r *Repo) RepoURL() string {
+	return rewriteURL(r.Root().Rewrite, r.Name, r.originURL())
+}
+
+// originURL resolves the repo url from the manifest, an existing checkout, the lock or the package import path
+func (r *Repo) originURL() string {
 	if r.URL != "" {
 		return r.URL
 	}
 	// If it's already installed in vendor or gopath, grab the url from there
 	repo := repoFromPath(r.PathOptions()...)
 	if repo != nil {
-		return repo.Remote()
+		return mirrorURL(repo.Remote())
+	}
+	if l, ok := locked[r.Name]; ok && len(l.URL) > 0 {
+		return l.URL
 	}
 	// Fallback to resolving the path from the package import path
 	// Add more cases as needed/requested
@@ -363,10 +841,19 @@ func (r *Repo) RepoURL() string {
 		if len(parts) == 2 {
 			parts[1] = fmt.Sprintf("go-%s", name)
 		}
-		r.Version = VersionFromString(nameParts[len(nameParts)-1])
+		// The .vN suffix selects the major version, unless a narrower constraint is given
+		if len(r.Version.String()) == 0 {
+			r.Version = VersionFromString(nameParts[len(nameParts)-1])
+		}
 		return fmt.Sprintf("git@github.com:%s/%s.git", parts[1], name)
 	}
-	return ""
+	// Discover the repository of vanity import paths through their go-import meta tag
+	i, err := goimport.Default.Resolve(r.Name)
+	if err != nil {
+		Logf("WARN Unable to resolve repository url of %s with error %s", r.Name, err.Error())
+		return ""
+	}
+	return i.RepoRoot
 }
 
 // RepoType attempts to resolve the repository type of the package by it's name
@@ -376,6 +863,9 @@ func (r *Repo) RepoType() vcs.Type {
 	if repo != nil {
 		return repo.Vcs()
 	}
+	if l, ok := locked[r.Name]; ok && len(l.Type) > 0 {
+		return l.Type
+	}
 	// Fallback to resolving the type from the package import path
 	// Add more cases as needed/requested
 	parts := strings.Split(r.Name, "/")
@@ -387,31 +877,170 @@ func (r *Repo) RepoType() vcs.Type {
 	case "gopkg.in":
 		return vcs.Git
 	}
+	i, err := goimport.Default.Resolve(r.Name)
+	if err != nil {
+		return vcs.NoVCS
+	}
+	if t, ok := vcsTypes[i.VCS]; ok {
+		return t
+	}
 	return vcs.NoVCS
 }
 
-// MarshalYAML implements yaml.Marsheler to prevent duplicate storage of nested packages with vgo.yaml
+// repoYAML describes the manifest layout of a Repo. The version is inlined so it's kind can be given explicitly using
+// one of the ver, branch, tag or rev keys.
+type repoYAML struct {
+	Name         string            `yaml:"name,omitempty"`
+	Main         []string          `yaml:"main,omitempty"`
+	Platforms    []string          `yaml:"platforms,omitempty"`
+	Tags         []string          `yaml:"tags,omitempty"`
+	Version      map[string]string `yaml:",inline"`
+	Reference    string            `yaml:"ref,omitempty"`
+	Dependencies []*Repo           `yaml:"deps,omitempty"`
+	TestDeps     []*Repo           `yaml:"test-deps,omitempty"`
+	Dev          []*Repo           `yaml:"dev,omitempty"` // alias of test-deps
+	URL          string            `yaml:"url,omitempty"`
+	Rewrite      []RewriteRule     `yaml:"rewrite,omitempty"`
+	Prune        *PruneOptions     `yaml:"prune,omitempty"`
+	Export       bool              `yaml:"export,omitempty"`
+}
+
+// MarshalYAML implements yaml.Marsheler to prevent duplicate storage of nested packages with vgo.yaml. An ordered
+// mapping is used since inlined keys would otherwise end up below the dependencies. Resolved references are stored in
+// vgo.lock instead.
 func (r *Repo) MarshalYAML() (interface{}, error) {
 	r.RLock()
-	copy := *r
-	r.RUnlock()
-	if copy.Name == "." {
-		copy.Name = ""
+	defer r.RUnlock()
+	data := yaml.MapSlice{}
+	if r.Name != "" && r.Name != "." {
+		data = append(data, yaml.MapItem{Key: "name", Value: r.Name})
+	}
+	if len(r.Main) > 0 {
+		data = append(data, yaml.MapItem{Key: "main", Value: r.Main})
+	}
+	if len(r.Platforms) > 0 {
+		data = append(data, yaml.MapItem{Key: "platforms", Value: r.Platforms})
+	}
+	if len(r.Tags) > 0 {
+		data = append(data, yaml.MapItem{Key: "tags", Value: r.Tags})
+	}
+	if key, ok := r.Version.manifestKey(); ok {
+		data = append(data, yaml.MapItem{Key: key, Value: r.Version.Ref})
+	}
+	if len(r.Dependencies) > 0 && !(r.hasManifest && !r.IsRoot()) {
+		deps, testDeps := []*Repo{}, []*Repo{}
+		for _, d := range r.Dependencies {
+			// Only the project has test dependencies, those of dependencies aren't installed
+			if d.test && r.IsRoot() {
+				testDeps = append(testDeps, d)
+			} else {
+				deps = append(deps, d)
+			}
+		}
+		if len(deps) > 0 {
+			data = append(data, yaml.MapItem{Key: "deps", Value: deps})
+		}
+		if len(testDeps) > 0 {
+			data = append(data, yaml.MapItem{Key: "test-deps", Value: testDeps})
+		}
+	}
+	if len(r.URL) > 0 {
+		data = append(data, yaml.MapItem{Key: "url", Value: r.URL})
+	}
+	if len(r.Rewrite) > 0 {
+		data = append(data, yaml.MapItem{Key: "rewrite", Value: r.Rewrite})
 	}
-	if copy.hasManifest && copy.parent != nil {
-		copy.Dependencies = []*Repo{}
+	if r.Prune != nil {
+		data = append(data, yaml.MapItem{Key: "prune", Value: r.Prune})
 	}
-	return copy, nil
+	if r.Export {
+		data = append(data, yaml.MapItem{Key: "export", Value: r.Export})
+	}
+	return data, nil
 }
 
-// Print ...
-func (r *Repo) Print(indent string, w io.Writer) {
-	r.print(indent, 0, w)
+// UnmarshalYAML implements yaml.Unmarshaler to resolve the inlined version
+func (r *Repo) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	data := repoYAML{}
+	err := unmarshal(&data)
+	if err != nil {
+		return err
+	}
+	v, err := versionFromMap(data.Version)
+	if err != nil {
+		return fmt.Errorf("Invalid version for %s: %s", data.Name, err.Error())
+	}
+	// Only fields present in the manifest are set, leaving the state of dependencies loading their own manifest intact
+	if len(data.Name) > 0 {
+		r.Name = data.Name
+	}
+	if len(data.Main) > 0 {
+		r.Main = data.Main
+	}
+	if len(data.Platforms) > 0 {
+		r.Platforms = data.Platforms
+	}
+	if len(data.Tags) > 0 {
+		r.Tags = data.Tags
+	}
+	if v.Kind != VersionTypeNone {
+		r.Version = v
+	}
+	if len(data.Reference) > 0 {
+		r.Reference = data.Reference
+	}
+	// Test dependencies are kept with the other dependencies so they're installed and locked alike
+	for _, d := range append(data.TestDeps, data.Dev...) {
+		d.test = true
+		data.Dependencies = append(data.Dependencies, d)
+	}
+	if len(data.Dependencies) > 0 {
+		r.Dependencies = data.Dependencies
+	}
+	if len(data.URL) > 0 {
+		r.URL = data.URL
+	}
+	if len(data.Rewrite) > 0 {
+		r.Rewrite = data.Rewrite
+	}
+	if data.Prune != nil {
+		r.Prune = data.Prune
+	}
+	if data.Export {
+		r.Export = data.Export
+	}
+	return nil
 }
 
-func (r *Repo) print(indent string, depth int, w io.Writer) {
-	w.Write([]byte(strings.Repeat(indent, depth) + r.Name + "\n"))
-	for _, d := range r.Dependencies {
-		d.print(indent, depth+1, w)
+// Print writes the dependency tree of the repo with the version, locked reference and status of each dependency.
+// Dependencies which were printed before are collapsed and marked with (*). A negative depth prints the whole tree.
+func (r *Repo) Print(w io.Writer, depth int) {
+	r.walk(map[string]*Repo{})
+	t := newTree(r, depth, func(d *Repo) []*Repo {
+		d.RLock()
+		defer d.RUnlock()
+		return d.Dependencies
+	})
+	r.print(t, "", "", 0, w)
+}
+
+func (r *Repo) print(t *tree, prefix, childPrefix string, depth int, w io.Writer) {
+	children := t.children(r)
+	line := prefix + t.label(r)
+	if t.seen[r.Name] && len(children) > 0 {
+		line += " (*)"
+		children = nil
+	}
+	t.seen[r.Name] = true
+	fmt.Fprintln(w, line)
+	if t.depth >= 0 && depth >= t.depth {
+		return
+	}
+	for i, d := range children {
+		if i == len(children)-1 {
+			d.print(t, childPrefix+"└── ", childPrefix+"    ", depth+1, w)
+			continue
+		}
+		d.print(t, childPrefix+"├── ", childPrefix+"│   ", depth+1, w)
 	}
 }
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/Masterminds/vcs"
+	"github.com/whitecypher/vgo/lib/checksum"
+	"github.com/whitecypher/vgo/lib/reporoot"
+)
+
+// States of a vendored dependency as reported by vgo status
+const (
+	StatusOK        = "ok"
+	StatusMissing   = "missing"
+	StatusDirty     = "dirty"
+	StatusChanged   = "changed"
+	StatusGone      = "gone"
+	StatusUnmanaged = "unmanaged"
+)
+
+// RepoStatus describes the drift of a vendored dependency from the manifest and lock
+type RepoStatus struct {
+	Name      string   `json:"name"`
+	States    []string `json:"states"`
+	Reference string   `json:"ref,omitempty"`
+	Checkout  string   `json:"checkout,omitempty"`
+}
+
+// OK returns whether the dependency is installed as described by the manifest and lock
+func (s RepoStatus) OK() bool {
+	return len(s.States) == 1 && s.States[0] == StatusOK
+}
+
+// Status compares the dependency graph of the repo with the vendor directory without changing either. Unless offline,
+// the remotes of the cached dependencies are checked for references which no longer exist upstream. Test dependencies
+// skipped due to --no-dev are left out along with the dependencies only they require.
+func (r *Repo) Status() []RepoStatus {
+	repos := map[string]*Repo{}
+	r.walk(repos)
+	skipped := r.skippedDeps(repos)
+	statuses := []RepoStatus{}
+	for name, d := range repos {
+		if d.IsRoot() || skipped[name] {
+			continue
+		}
+		statuses = append(statuses, d.status())
+	}
+	for _, name := range vendoredRepos(filepath.Join(r.Path(), "vendor"), repos) {
+		statuses = append(statuses, RepoStatus{Name: name, States: []string{StatusUnmanaged}})
+	}
+	sort.Sort(repoStatuses(statuses))
+	return statuses
+}
+
+func (r *Repo) status() RepoStatus {
+	r.RLock()
+	s := RepoStatus{Name: r.Name, Reference: r.Reference}
+	r.RUnlock()
+	repo, missing, dirty := r.vendorState()
+	if missing {
+		s.States = []string{StatusMissing}
+		return s
+	}
+	if r.isExported() {
+		// Exported files match the locked reference unless they were changed
+		s.Checkout = s.Reference
+	} else {
+		s.Checkout, _ = repo.Version()
+	}
+	if dirty {
+		s.States = append(s.States, StatusDirty)
+	}
+	if len(s.Reference) > 0 && !sameReference(s.Reference, s.Checkout) {
+		s.States = append(s.States, StatusChanged)
+	}
+	if len(s.Reference) > 0 && !offline {
+		if l, ok := locked[r.Name]; ok && len(l.URL) > 0 && isGone(NewMirror(l.Type, l.URL), s.Reference) {
+			s.States = append(s.States, StatusGone)
+		}
+	}
+	if len(s.States) == 0 {
+		s.States = []string{StatusOK}
+	}
+	return s
+}
+
+// sameReference compares references which may be abbreviated
+func sameReference(a, b string) bool {
+	if len(a) == 0 || len(b) == 0 {
+		return false
+	}
+	return strings.HasPrefix(a, b) || strings.HasPrefix(b, a)
+}
+
+// isGone checks whether the reference is still reachable from any of the branches or tags of the remote. Git remotes
+// are fetched into a temporary repository which borrows the objects of the mirror, so the cache isn't changed. Hg
+// mirrors are only checked for the reference itself. Repos without a mirror are assumed to be fine.
+func isGone(m *Mirror, ref string) bool {
+	if m == nil || !m.Exists() {
+		return false
+	}
+	if m.Type != vcs.Git {
+		return !m.HasReference(ref)
+	}
+	dir, err := ioutil.TempDir("", "vgo-status")
+	if err != nil {
+		return false
+	}
+	defer os.RemoveAll(dir)
+	if m.run("", "git", "init", "--bare", "--quiet", dir) != nil {
+		return false
+	}
+	alternates := filepath.Join(dir, "objects", "info", "alternates")
+	err = ioutil.WriteFile(alternates, []byte(filepath.Join(m.Path, "objects")+"\n"), os.FileMode(0644))
+	if err != nil {
+		return false
+	}
+	err = m.run(dir, "git", "fetch", "--quiet", m.URL, "+refs/heads/*:refs/heads/*", "+refs/tags/*:refs/tags/*")
+	if err != nil {
+		return false
+	}
+	out, err := m.output(dir, "git", "for-each-ref", "--count=1", "--contains", ref)
+	return err != nil || len(bytes.TrimSpace(out)) == 0
+}
+
+// vendoredRepos finds the names of the repos within the vendor dir which aren't known. These are checkouts, or the
+// repo roots of files outside of the known repos when vendored without metadata.
+func vendoredRepos(dir string, known map[string]*Repo) (names []string) {
+	filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || path == dir {
+			return nil
+		}
+		rel, _ := filepath.Rel(dir, path)
+		rel = filepath.ToSlash(rel)
+		if !info.IsDir() {
+			if !strings.Contains(rel, "/") {
+				// Files of other tools e.g. vendor/vendor.json
+				return nil
+			}
+			root := reporoot.Heuristic(filepath.ToSlash(filepath.Dir(rel)))
+			if r, ok := reporoot.Known(rel); ok {
+				root = r
+			}
+			if len(names) == 0 || names[len(names)-1] != root {
+				names = append(names, root)
+			}
+			return nil
+		}
+		if _, ok := known[rel]; ok || checksum.IsVCSDir(info.Name()) {
+			return filepath.SkipDir
+		}
+		for _, d := range []string{".git", ".hg", ".bzr", ".svn"} {
+			if _, err := os.Stat(filepath.Join(path, d)); err == nil {
+				names = append(names, rel)
+				return filepath.SkipDir
+			}
+		}
+		return nil
+	})
+	return uniqueStrings(names)
+}
+
+// PrintStatus writes the statuses as a table or as json
+func PrintStatus(w io.Writer, statuses []RepoStatus, asJSON bool) error {
+	if asJSON {
+		data, err := json.MarshalIndent(statuses, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(w, string(data))
+		return err
+	}
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tSTATUS\tREF\tCHECKOUT")
+	for _, s := range statuses {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", s.Name, strings.Join(s.States, ","), shortReference(s.Reference), shortReference(s.Checkout))
+	}
+	return tw.Flush()
+}
+
+// shortReference abbreviates commit hashes for display
+func shortReference(ref string) string {
+	if len(ref) > 12 && regexRevision.MatchString(ref) {
+		return ref[:12]
+	}
+	return ref
+}
+
+// repoStatuses sorts statuses by name
+type repoStatuses []RepoStatus
+
+func (s repoStatuses) Len() int           { return len(s) }
+func (s repoStatuses) Less(i, j int) bool { return s[i].Name < s[j].Name }
+func (s repoStatuses) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// tree holds the state of printing a dependency tree
+type tree struct {
+	depth    int
+	children func(*Repo) []*Repo
+	seen     map[string]bool
+	// conflicts contains the repos for which no reference satisfies the versions required throughout the tree
+	conflicts map[string]bool
+}
+
+func newTree(root *Repo, depth int, children func(*Repo) []*Repo) *tree {
+	t := &tree{
+		depth:     depth,
+		children:  children,
+		seen:      map[string]bool{},
+		conflicts: map[string]bool{},
+	}
+	first := map[string]*Repo{}
+	versions := map[string]map[string]bool{}
+	root.eachInstance(map[*Repo]bool{}, func(r *Repo) {
+		if r.IsRoot() {
+			return
+		}
+		if _, ok := first[r.Name]; !ok {
+			first[r.Name] = r
+			versions[r.Name] = map[string]bool{}
+		}
+		if v := r.Version.String(); len(v) > 0 {
+			versions[r.Name][v] = true
+		}
+	})
+	for name, r := range first {
+		// A single version can't conflict, the installed repo is needed to resolve several
+		if len(versions[name]) < 2 {
+			continue
+		}
+		repo, _, _ := r.installedReference()
+		if repo == nil {
+			continue
+		}
+		_, err := resolveConstraints(repo, name, verifyConstraints(repo, r.Constraints()))
+		if _, ok := err.(ConflictError); ok {
+			t.conflicts[name] = true
+		}
+	}
+	return t
+}
+
+// eachInstance calls fn for every repo in the tree, including repeated instances of the same repo
+func (r *Repo) eachInstance(visited map[*Repo]bool, fn func(*Repo)) {
+	if visited[r] {
+		return
+	}
+	visited[r] = true
+	fn(r)
+	r.RLock()
+	deps := r.Dependencies
+	r.RUnlock()
+	for _, d := range deps {
+		d.eachInstance(visited, fn)
+	}
+}
+
+// label describes the repo by it's name, version, locked reference and status markers
+func (t *tree) label(r *Repo) string {
+	if r.IsRoot() {
+		return r.Name
+	}
+	r.RLock()
+	parts := []string{r.Name}
+	if v := r.Version.String(); len(v) > 0 {
+		parts = append(parts, v)
+	}
+	ref := r.Reference
+	r.RUnlock()
+	markers := []string{}
+	repo, missing, dirty := r.vendorState()
+	if missing {
+		markers = append(markers, StatusMissing)
+	}
+	if dirty {
+		markers = append(markers, StatusDirty)
+	}
+	if repo != nil && len(ref) > 0 {
+		tags, _ := repo.TagsFromCommit(ref)
+		if best, ok := VersionFromString("*").Best(tags); ok {
+			ref = best
+		}
+	}
+	if len(ref) > 0 {
+		parts = append(parts, shortReference(ref))
+	}
+	if t.conflicts[r.Name] {
+		markers = append(markers, "conflict")
+	}
+	if len(markers) > 0 {
+		parts = append(parts, "["+strings.Join(markers, ", ")+"]")
+	}
+	return strings.Join(parts, " ")
+}
+
+// PrintInverted writes the reverse dependency tree of the named repo, listing the repos which depend on it up to the
+// project root
+func (r *Repo) PrintInverted(w io.Writer, name string, depth int) error {
+	first := map[string]*Repo{}
+	dependents := map[string][]*Repo{}
+	r.walk(map[string]*Repo{})
+	r.eachInstance(map[*Repo]bool{}, func(p *Repo) {
+		if _, ok := first[p.Name]; !ok {
+			first[p.Name] = p
+		}
+		p.RLock()
+		deps := p.Dependencies
+		p.RUnlock()
+		for _, d := range deps {
+			known := false
+			for _, dp := range dependents[d.Name] {
+				known = known || dp.Name == p.Name
+			}
+			if !known {
+				dependents[d.Name] = append(dependents[d.Name], first[p.Name])
+			}
+		}
+	})
+	target, ok := first[name]
+	if !ok {
+		target, ok = first[repoRoots.Root(name)]
+	}
+	if !ok {
+		return fmt.Errorf("%s is not a dependency of %s", name, r.Name)
+	}
+	t := newTree(r, depth, func(d *Repo) []*Repo {
+		return dependents[d.Name]
+	})
+	target.print(t, "", "", 0, w)
+	return nil
+}
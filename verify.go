@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/whitecypher/vgo/lib/checksum"
+)
+
+// Verify recomputes the checksums of all locked dependencies in the vendor directory and reports the files which were
+// added, removed or modified since they were installed. Returns false if the lock file couldn't be read, any dependency
+// of the manifests isn't locked or any dependency differs from the lock. Test dependencies skipped due to --no-dev and
+// the dependencies only they require aren't verified.
+func (r *Repo) Verify(w io.Writer) bool {
+	if lockErr != nil {
+		fmt.Fprintf(w, "FAIL %s\n", lockErr.Error())
+		return false
+	}
+	ok := true
+	repos := map[string]*Repo{}
+	r.walk(repos)
+	skipped := r.skippedDeps(repos)
+	unlocked := []string{}
+	for name, d := range repos {
+		if _, isLocked := locked[name]; !isLocked && !d.IsRoot() && !skipped[name] {
+			unlocked = append(unlocked, name)
+		}
+	}
+	sort.Strings(unlocked)
+	for _, name := range unlocked {
+		fmt.Fprintf(w, "UNLOCKED %s\n", name)
+		ok = false
+	}
+	names := make([]string, 0, len(locked))
+	for name := range locked {
+		if skipped[name] {
+			continue
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		l := locked[name]
+		dir := filepath.Join(r.Path(), "vendor", name)
+		if _, err := os.Stat(dir); err != nil {
+			fmt.Fprintf(w, "MISSING %s\n", name)
+			ok = false
+			continue
+		}
+		files, err := checksum.Files(dir)
+		if err != nil {
+			fmt.Fprintf(w, "FAIL %s %s\n", name, err.Error())
+			ok = false
+			continue
+		}
+		if checksum.Sum(files) == l.Hash {
+			fmt.Fprintf(w, "OK %s\n", name)
+			continue
+		}
+		ok = false
+		fmt.Fprintf(w, "FAIL %s\n", name)
+		if l.Files == nil {
+			fmt.Fprintf(w, "  checksum %s does not match %s\n", checksum.Sum(files), l.Hash)
+			continue
+		}
+		added, removed, modified := checksum.Diff(l.Files, files)
+		for _, f := range added {
+			fmt.Fprintf(w, "  + %s\n", f)
+		}
+		for _, f := range removed {
+			fmt.Fprintf(w, "  - %s\n", f)
+		}
+		for _, f := range modified {
+			fmt.Fprintf(w, "  M %s\n", f)
+		}
+	}
+	return ok
+}
@@ -1,5 +1,14 @@
 package main
 
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	semver "github.com/whitecypher/vgo/lib/version"
+)
+
 // VersionType enum type
 type VersionType int
 
@@ -12,45 +21,153 @@ const (
 	VersionTypeSemVer
 )
 
-var noVersion = Version{
-	Kind: VersionTypeNone,
-}
+var (
+	noVersion = Version{
+		Kind: VersionTypeNone,
+	}
+	regexRevision = regexp.MustCompile("^[0-9a-fA-F]{7,40}$")
+	// versionKeys maps each VersionType to it's manifest key
+	versionKeys = map[VersionType]string{
+		VersionTypeRef:    "rev",
+		VersionTypeBranch: "branch",
+		VersionTypeTag:    "tag",
+		VersionTypeSemVer: "ver",
+	}
+)
 
+// NoVersion returns an empty Version
 func NoVersion() Version {
 	return noVersion
 }
 
-// VersionFromString creates a Version instance from a string
+// VersionFromString creates a Version instance from a string. Version constraints such as "^1.4" or "1.x" are
+// resolved as VersionTypeSemVer and commit hashes as VersionTypeRef. Anything else is assumed to be a branch until
+// verified against the VCS.
 func VersionFromString(v string) Version {
+	if len(v) == 0 {
+		return NoVersion()
+	}
+	kind := VersionTypeBranch
+	if semver.IsConstraint(v) {
+		kind = VersionTypeSemVer
+	} else if regexRevision.MatchString(v) {
+		kind = VersionTypeRef
+	}
 	return Version{
-		Kind: VersionTypeSemVer,
-		Ref: v,
+		Kind:    kind,
+		Ref:     v,
+		guessed: kind == VersionTypeBranch,
 	}
 }
 
+// versionFromMap creates a Version from it's manifest form. Only one of the ver, branch, tag or rev keys may be given.
+// The kind of a ver value is resolved from the string for compatibility with manifests without explicit kinds.
+func versionFromMap(m map[string]string) (Version, error) {
+	v := NoVersion()
+	keys := []string{}
+	for key, ref := range m {
+		keys = append(keys, key)
+		if key == versionKeys[VersionTypeSemVer] {
+			v = VersionFromString(ref)
+			continue
+		}
+		found := false
+		for kind, k := range versionKeys {
+			if k == key {
+				v = Version{Kind: kind, Ref: ref}
+				found = true
+			}
+		}
+		if !found {
+			return NoVersion(), fmt.Errorf("Unknown key %s", key)
+		}
+	}
+	if len(keys) > 1 {
+		sort.Strings(keys)
+		return NoVersion(), fmt.Errorf("Only one of ver, branch, tag or rev may be given, found %s", strings.Join(keys, ", "))
+	}
+	return v, nil
+}
+
 // Version compatibility string e.g. "~1.0.0" or "1.*"
 type Version struct {
 	Kind VersionType
-	Ref string
-}
-//
-// // IsCompatibleWith checks if given version is compatible
-// func (v Version) IsCompatibleWith(t Version) bool {
-// 	if v.Kind == t.Kind && v.Kind == VersionTypeSemVer {
-// 		vRef := strings.Trim(v.Ref, "vV")
-// 		tRef := strings.Trim(t.Ref, "vV")
-// 		_ = vRef
-// 		_ = tRef
-// 	} else {
-// 		return v.Ref == t.Ref
-// 	}
-// 	return false
-// }
+	Ref  string
+	// guessed is set when the kind was assumed from a plain string rather than declared, only these are verified
+	// against the VCS and they're stored using the ver key as given
+	guessed bool
+}
+
+// IsCompatibleWith checks if given version is compatible
+func (v Version) IsCompatibleWith(t Version) bool {
+	if v.Kind == VersionTypeNone {
+		return true
+	}
+	if v.Ref == t.Ref {
+		return true
+	}
+	if v.Kind == VersionTypeSemVer {
+		return semver.FromString(v.Ref).IsCompatibleWith(semver.FromString(t.Ref))
+	}
+	return false
+}
+
+// Best selects the highest tag satisfying the version constraint
+func (v Version) Best(tags []string) (string, bool) {
+	if v.Kind != VersionTypeSemVer {
+		return "", false
+	}
+	c, err := semver.ParseConstraint(v.Ref)
+	if err != nil {
+		return "", false
+	}
+	return c.Best(tags)
+}
 
 func (v Version) String() string {
 	return v.Ref
 }
 
-// Marshal YAML
+// yamlMap returns the manifest form of the version keyed by it's kind e.g. {"branch": "develop"}
+func (v Version) yamlMap() map[string]string {
+	key, ok := v.manifestKey()
+	if !ok {
+		return nil
+	}
+	return map[string]string{key: v.Ref}
+}
 
-// UnmarshalYAML
+// manifestKey returns the manifest key of the version. Versions of which the kind was guessed keep the ver key so the
+// kind verified against the VCS isn't stored.
+func (v Version) manifestKey() (string, bool) {
+	key, ok := versionKeys[v.Kind]
+	if !ok || len(v.Ref) == 0 {
+		return "", false
+	}
+	if v.guessed {
+		key = versionKeys[VersionTypeSemVer]
+	}
+	return key, true
+}
+
+// MarshalYAML implements yaml.Marshaler to store the version keyed by it's kind e.g. "branch: develop" or "ver: ^1.4"
+func (v Version) MarshalYAML() (interface{}, error) {
+	return v.yamlMap(), nil
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler to read the version keyed by it's kind or from a plain string
+func (v *Version) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var ref string
+	err := unmarshal(&ref)
+	if err == nil {
+		*v = VersionFromString(ref)
+		return nil
+	}
+	m := map[string]string{}
+	err = unmarshal(&m)
+	if err != nil {
+		return err
+	}
+	*v, err = versionFromMap(m)
+	return err
+}
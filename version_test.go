@@ -0,0 +1,65 @@
+package main
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v2"
+)
+
+func TestVersionKeysRoundTrip(t *testing.T) {
+	cases := []struct {
+		manifest string
+		kind     VersionType
+	}{
+		{"name: github.com/foo/bar\nver: ^1.4\n", VersionTypeSemVer},
+		{"name: github.com/foo/bar\nbranch: develop\n", VersionTypeBranch},
+		{"name: github.com/foo/bar\ntag: v1.4.2\n", VersionTypeTag},
+		{"name: github.com/foo/bar\nrev: 3f2a9c1d\n", VersionTypeRef},
+		// Plain strings keep the ver key even though their kind is guessed
+		{"name: github.com/foo/bar\nver: develop\n", VersionTypeBranch},
+	}
+	for _, c := range cases {
+		r := &Repo{}
+		if !assert.Nil(t, yaml.Unmarshal([]byte(c.manifest), r), "Expected %q to be read", c.manifest) {
+			continue
+		}
+		assert.Equal(t, c.kind, r.Version.Kind, "Expected the kind of %q", c.manifest)
+		data, err := yaml.Marshal(r)
+		assert.Nil(t, err)
+		assert.Equal(t, c.manifest, string(data))
+	}
+}
+
+func TestVersionKeysConflict(t *testing.T) {
+	r := &Repo{}
+	err := yaml.Unmarshal([]byte("name: github.com/foo/bar\nbranch: develop\ntag: v1.4.2\n"), r)
+	if assert.NotNil(t, err) {
+		assert.Equal(t, "Invalid version for github.com/foo/bar: Only one of ver, branch, tag or rev may be given, found branch, tag", err.Error())
+	}
+	_, err = versionFromMap(map[string]string{"commit": "3f2a9c1d"})
+	assert.NotNil(t, err, "Expected unknown keys to be rejected")
+}
+
+func TestVersionKeepsExplicitKind(t *testing.T) {
+	// The branch and the tag share their name
+	repo := gitRepo(t, "release")
+	defer os.RemoveAll(repo.LocalPath())
+	for _, args := range [][]string{{"branch", "release"}, {"fetch", "--quiet", "origin"}} {
+		if out, err := repo.RunFromDir("git", args...); err != nil {
+			t.Fatalf("git %v failed with %s: %s", args, err, out)
+		}
+	}
+
+	for _, key := range []string{"tag", "branch"} {
+		v, err := versionFromMap(map[string]string{key: "release"})
+		assert.Nil(t, err)
+		v = verifyVersion(repo, v)
+		assert.Equal(t, key, versionKeys[v.Kind], "Expected the declared kind to be kept")
+		assert.Equal(t, map[string]string{key: "release"}, v.yamlMap())
+	}
+	v := verifyVersion(repo, VersionFromString("release"))
+	assert.Equal(t, VersionTypeBranch, v.Kind, "Expected guessed versions to prefer the branch")
+	assert.Equal(t, map[string]string{"ver": "release"}, v.yamlMap())
+}
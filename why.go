@@ -0,0 +1,180 @@
+package main
+
+import (
+	"fmt"
+	"go/build"
+	"go/token"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/whitecypher/vgo/lib/native"
+)
+
+// Import is a single import statement of an import chain
+type Import struct {
+	Importer string
+	Imported string
+	Pos      token.Position
+}
+
+// ImportChain is a list of imports leading from a main package to a dependency. The context names the platform or tags
+// which introduce the chain, it's empty for chains of the host platform.
+type ImportChain struct {
+	Context string
+	Imports []Import
+}
+
+// Why finds every shortest import chain from the main packages of the project to the named package or to any package
+// of the named repo for each build context. All project packages are used as starting points when no main packages are
+// declared. Chains of other platforms or tags are only listed when they weren't found for a previous context. Packages
+// which are only imported by tests are traced from the test files of all project packages, with "test" in the context.
+func (r *Repo) Why(name string) []ImportChain {
+	chains := []ImportChain{}
+	seen := map[string]bool{}
+	add := func(label string, found [][]Import) {
+		for _, imports := range found {
+			key := fmt.Sprint(imports)
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			chains = append(chains, ImportChain{Context: label, Imports: imports})
+		}
+	}
+	for _, ctxt := range r.BuildContexts() {
+		add(ctxt.Label, ctxt.why(r.MainPkgs(ctxt), name, false))
+	}
+	if len(chains) > 0 {
+		return chains
+	}
+	for _, ctxt := range r.BuildContexts() {
+		label := "test"
+		if len(ctxt.Label) > 0 {
+			label += ", " + ctxt.Label
+		}
+		add(label, ctxt.why(ProjectPkgs(ctxt, cwd), name, true))
+	}
+	return chains
+}
+
+// why finds the shortest import chains from the given packages to the named package or repo in the build context. With
+// tests the given packages are left through the imports of their test files instead.
+func (ctxt *BuildContext) why(starts []*build.Package, name string, tests bool) [][]Import {
+	// Breadth first search recording all importers at the shortest distance of each package
+	parents := map[string][]Import{}
+	dist := map[string]int{}
+	queue := []*build.Package{}
+	for _, bp := range starts {
+		if _, ok := dist[bp.ImportPath]; !ok {
+			dist[bp.ImportPath] = 0
+			queue = append(queue, bp)
+		}
+	}
+	targets := []string{}
+	found := -1
+	for len(queue) > 0 {
+		bp := queue[0]
+		queue = queue[1:]
+		d := dist[bp.ImportPath]
+		if found >= 0 && d >= found {
+			break
+		}
+		imports, positions := bp.Imports, bp.ImportPos
+		if tests && d == 0 {
+			imports = append(append([]string{}, bp.TestImports...), bp.XTestImports...)
+			positions = map[string][]token.Position{}
+			for _, pos := range []map[string][]token.Position{bp.TestImportPos, bp.XTestImportPos} {
+				for i, p := range pos {
+					positions[i] = append(positions[i], p...)
+				}
+			}
+		}
+		for _, i := range imports {
+			if i == "C" || native.IsNative(i) {
+				continue
+			}
+			dep, err := ctxt.Import(i, bp.Dir, build.ImportMode(0))
+			if err != nil && dep.Dir == "" {
+				continue
+			}
+			pos := token.Position{}
+			if p := positions[i]; len(p) > 0 {
+				pos = p[0]
+			}
+			imp := Import{Importer: bp.ImportPath, Imported: dep.ImportPath, Pos: pos}
+			if dd, ok := dist[dep.ImportPath]; ok {
+				if dd == d+1 {
+					parents[dep.ImportPath] = append(parents[dep.ImportPath], imp)
+				}
+				continue
+			}
+			dist[dep.ImportPath] = d + 1
+			parents[dep.ImportPath] = []Import{imp}
+			if hasPathPrefix(importName(dep.ImportPath), name) {
+				targets = append(targets, dep.ImportPath)
+				found = d + 1
+				continue
+			}
+			queue = append(queue, dep)
+		}
+	}
+
+	chains := [][]Import{}
+	sort.Strings(targets)
+	for _, t := range targets {
+		chains = append(chains, chainsTo(t, parents)...)
+	}
+	return chains
+}
+
+// chainsTo builds all import chains leading to the package from the recorded importers
+func chainsTo(pkg string, parents map[string][]Import) [][]Import {
+	imports, ok := parents[pkg]
+	if !ok {
+		return [][]Import{{}}
+	}
+	chains := [][]Import{}
+	for _, imp := range imports {
+		for _, c := range chainsTo(imp.Importer, parents) {
+			chains = append(chains, append(c, imp))
+		}
+	}
+	return chains
+}
+
+// importName removes any vendor path prefixes from the import path
+func importName(importPath string) string {
+	return (&Pkg{Name: importPath}).ImportName()
+}
+
+// hasPathPrefix checks whether the import path equals or is contained in prefix
+func hasPathPrefix(importPath, prefix string) bool {
+	return importPath == prefix || strings.HasPrefix(importPath, prefix+"/")
+}
+
+// PrintImportChains writes each import chain with the file and line of every import statement. Chains introduced by a
+// platform or tag are followed by it in parentheses.
+func PrintImportChains(w io.Writer, chains []ImportChain) {
+	for i, c := range chains {
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		if len(c.Imports) == 0 {
+			continue
+		}
+		if len(c.Context) > 0 {
+			fmt.Fprintf(w, "%s (%s)\n", importName(c.Imports[0].Importer), c.Context)
+		} else {
+			fmt.Fprintln(w, importName(c.Imports[0].Importer))
+		}
+		for _, imp := range c.Imports {
+			file := imp.Pos.Filename
+			if rel, err := filepath.Rel(cwd, file); err == nil {
+				file = rel
+			}
+			fmt.Fprintf(w, "  %s:%d imports %s\n", file, imp.Pos.Line, importName(imp.Imported))
+		}
+	}
+}